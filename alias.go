@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// aliasSuggestionThreshold is the artist similarity from which a library artist is suggested as an alias
+const aliasSuggestionThreshold = 0.8
+
+// ArtistAlias is a line of the alias file, naming the library artists that a Last.fm
+// artist is found under. Lines look like
+//
+//	坂本龍一 = Ryuichi Sakamoto | Sakamoto Ryuichi   # romanized in the library
+//
+// where several library names are separated by "|" and the text after " #" is a note.
+type ArtistAlias struct {
+	Line    int
+	Artist  string   // as on Last.fm
+	Library []string // as in the library
+	Note    string
+}
+
+// String formats the alias as a line of the alias file
+func (a ArtistAlias) String() string {
+	line := a.Artist + " = " + strings.Join(a.Library, " | ")
+	if a.Note != "" {
+		line += " # " + a.Note
+	}
+	return line
+}
+
+// loadArtistAliases reads the alias file at filePath, reporting malformed lines as warnings on stderr
+func loadArtistAliases(filePath string) ([]ArtistAlias, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading alias file: %w", err)
+	}
+	defer file.Close()
+
+	aliases, warnings, err := parseArtistAliases(file)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s:%s\n", filePath, warning)
+	}
+	return aliases, err
+}
+
+// parseArtistAliases parses alias lines, skipping blank lines and # comments and
+// returning problems with single lines as "line N: problem"
+func parseArtistAliases(r io.Reader) (aliases []ArtistAlias, warnings []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		alias := ArtistAlias{Line: lineNum}
+		if i := strings.Index(line, " #"); i >= 0 {
+			alias.Note = strings.TrimSpace(line[i+2:])
+			line = line[:i]
+		}
+
+		artist, library, ok := strings.Cut(line, "=")
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("line %d: expected LAST.FM ARTIST = LIBRARY ARTIST, got %q", lineNum, line))
+			continue
+		}
+		alias.Artist = strings.TrimSpace(artist)
+		for _, name := range strings.Split(library, "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				alias.Library = append(alias.Library, name)
+			}
+		}
+		if alias.Artist == "" || len(alias.Library) == 0 {
+			warnings = append(warnings, fmt.Sprintf("line %d: both the Last.fm and a library artist are needed", lineNum))
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, warnings, scanner.Err()
+}
+
+// artistNames returns the normalized names under which the artist may appear in the library:
+// its own name followed by its aliases
+func (m *Matcher) artistNames(artist string) []string {
+	n := m.normalizer()
+	var names []string
+	for _, name := range m.searchNames(artist) {
+		if name = n.Artist(name); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// searchNames returns the names to search the library for the artist by, as they are written:
+// its own name followed by the library names of its aliases
+func (m *Matcher) searchNames(artist string) []string {
+	names := []string{artist}
+	if m == nil {
+		return names
+	}
+
+	n := m.normalizer()
+	normalized := n.Artist(artist)
+	for _, alias := range m.Aliases {
+		if n.Artist(alias.Artist) == normalized {
+			names = append(names, alias.Library...)
+		}
+	}
+	return names
+}
+
+// aliasSuggestion is a library artist that may be a Last.fm artist under another name
+type aliasSuggestion struct {
+	Artist  string  // as on Last.fm
+	Library string  // as in the library
+	Score   float64 // similarity of the names
+	Albums  int     // top albums of the artist
+}
+
+// suggestAliases looks for the artists of topAlbums that are not in the library under their
+// own name or an alias, and suggests the most similar library artist for each, if any is
+// similar enough. Suggestions are ordered by the number of top albums of the artist.
+func suggestAliases(topAlbums []Album, libraryArtists []SubsonicArtist, matcher *Matcher) []aliasSuggestion {
+	n := matcher.normalizer()
+	library := make(map[string]string, len(libraryArtists))
+	for _, artist := range libraryArtists {
+		library[n.Artist(artist.Name)] = artist.Name
+	}
+
+	var order []string
+	albums := make(map[string]int)
+	for _, album := range topAlbums {
+		if albums[album.Artist.Name] == 0 {
+			order = append(order, album.Artist.Name)
+		}
+		albums[album.Artist.Name]++
+	}
+
+	var suggestions []aliasSuggestion
+	for _, artist := range order {
+		names := matcher.artistNames(artist)
+		if slices.ContainsFunc(names, func(name string) bool { return library[name] != "" }) {
+			continue
+		}
+
+		best := aliasSuggestion{Artist: artist, Albums: albums[artist]}
+		for normalized, name := range library {
+			score := similarity(names[0], normalized)
+			if score > best.Score || (score == best.Score && name < best.Library) {
+				best.Library, best.Score = name, score
+			}
+		}
+		if best.Score >= aliasSuggestionThreshold {
+			suggestions = append(suggestions, best)
+		}
+	}
+
+	slices.SortStableFunc(suggestions, func(a, b aliasSuggestion) int {
+		return cmp.Compare(b.Albums, a.Albums)
+	})
+	return suggestions
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseArtistAliases(t *testing.T) {
+	input := `# Last.fm = library
+坂本龍一 = Ryuichi Sakamoto | Sakamoto Ryuichi   # romanized
+AC/DC=ACDC
+
+no separator here
+ = Nobody
+Somebody = |
+`
+	aliases, warnings, err := parseArtistAliases(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(aliases) != 2 {
+		t.Fatalf("Expected 2 aliases, got %+v", aliases)
+	}
+	if aliases[0].Line != 2 || aliases[0].Artist != "坂本龍一" || strings.Join(aliases[0].Library, "|") != "Ryuichi Sakamoto|Sakamoto Ryuichi" || aliases[0].Note != "romanized" {
+		t.Errorf("Unexpected first alias %+v", aliases[0])
+	}
+	if aliases[0].String() != "坂本龍一 = Ryuichi Sakamoto | Sakamoto Ryuichi # romanized" {
+		t.Errorf("Unexpected alias line %q", aliases[0].String())
+	}
+	if aliases[1].Artist != "AC/DC" || aliases[1].Library[0] != "ACDC" {
+		t.Errorf("Unexpected second alias %+v", aliases[1])
+	}
+
+	if len(warnings) != 3 || !strings.HasPrefix(warnings[0], "line 5:") || !strings.HasPrefix(warnings[1], "line 6:") || !strings.HasPrefix(warnings[2], "line 7:") {
+		t.Errorf("Expected warnings for lines 5 to 7, got %q", warnings)
+	}
+}
+
+func TestMatcherAliases(t *testing.T) {
+	matcher := &Matcher{Threshold: 1, Aliases: []ArtistAlias{
+		{Artist: "坂本龍一", Library: []string{"Ryuichi Sakamoto", "Sakamoto Ryuichi"}},
+	}}
+
+	names := matcher.artistNames("坂本龍一")
+	if strings.Join(names, "|") != "坂本龍一|ryuichi sakamoto|sakamoto ryuichi" {
+		t.Errorf("Unexpected artist names %q", names)
+	}
+
+	candidates := []matchCandidate{{Artist: "Sakamoto Ryuichi", Title: "async"}}
+	if _, _, ok := matcher.Best(testAlbum("坂本龍一", "async"), candidates); !ok {
+		t.Error("Expected the alias to match the library artist")
+	}
+	if _, _, ok := matcher.Best(testAlbum("Ryuichi Sakamoto", "async"), candidates); ok {
+		t.Error("Expected aliases to apply to the Last.fm artist only")
+	}
+}
+
+func TestLibraryIndexAliases(t *testing.T) {
+	var offsets []int
+	server := newAlbumListServer(t, 2, &offsets)
+	defer server.Close()
+
+	client := NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass")
+	client.matcher = &Matcher{Threshold: 0.9, Aliases: []ArtistAlias{{Artist: "Der Künstler", Library: []string{"The Artist"}}}}
+	index, err := LoadLibraryIndex(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for album, expected := range map[string]bool{"Album 1": true, "Albun 1": true, "Album 7": false} {
+		exists, err := index.HasAlbum(context.Background(), testAlbum("Der Künstler", album))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != expected {
+			t.Errorf("Der Künstler - %s: expected %v, got %v", album, expected, exists)
+		}
+	}
+}
+
+func TestSuggestAliases(t *testing.T) {
+	topAlbums := []Album{
+		testAlbum("Dream Theatre", "Awake"),
+		testAlbum("Sigur Ros", "Takk"),
+		testAlbum("Dream Theatre", "Octavarium"),
+		testAlbum("Poppy", "Zig"),
+		testAlbum("Someone New", "Debut"),
+		testAlbum("坂本龍一", "async"),
+	}
+	library := []SubsonicArtist{
+		{Name: "Dream Theater"},
+		{Name: "Sigur Rós"},
+		{Name: "Poppy"},
+		{Name: "Ryuichi Sakamoto"},
+	}
+	matcher := &Matcher{Aliases: []ArtistAlias{{Artist: "坂本龍一", Library: []string{"Ryuichi Sakamoto"}}}}
+
+	suggestions := suggestAliases(topAlbums, library, matcher)
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected 2 suggestions, got %+v", suggestions)
+	}
+	if s := suggestions[0]; s.Artist != "Dream Theatre" || s.Library != "Dream Theater" || s.Albums != 2 || s.Score < 0.9 {
+		t.Errorf("Unexpected first suggestion %+v", s)
+	}
+	if s := suggestions[1]; s.Artist != "Sigur Ros" || s.Library != "Sigur Rós" || s.Albums != 1 {
+		t.Errorf("Unexpected second suggestion %+v", s)
+	}
+
+	normalizer := &Normalizer{FoldDiacritics: true}
+	matcher.Normalizer = normalizer
+	for _, s := range suggestAliases(topAlbums, library, matcher) {
+		if s.Artist == "Sigur Ros" {
+			t.Error("Expected no suggestion for an artist that matches once accents are folded")
+		}
+	}
+}
+
+func TestRunAliasesList(t *testing.T) {
+	isolateConfig(t)
+	aliasFile := filepath.Join(t.TempDir(), "aliases")
+	if err := os.WriteFile(aliasFile, []byte("AC/DC = ACDC # tagged without slash\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		if code := run([]string{"aliases", "--alias-file", aliasFile}); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+	if fields := strings.Fields(output); strings.Join(fields, " ") != "1 AC/DC ACDC tagged without slash" {
+		t.Errorf("Unexpected alias list %q", output)
+	}
+
+	captureStdout(t, func() {
+		if code := run([]string{"aliases", "--alias-file", aliasFile, "frobnicate"}); code != 2 {
+			t.Errorf("Expected usage error, got %d", code)
+		}
+	})
+}
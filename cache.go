@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// lookupCacheVersion is bumped whenever the cache file layout changes; older files are discarded
+const lookupCacheVersion = 2
+
+// lookupCacheFile is the on-disk layout of the lookup cache
+type lookupCacheFile struct {
+	Version int                         `json:"version"`
+	Server  string                      `json:"server"`
+	Matcher string                      `json:"matcher"` // Matcher.Fingerprint of the run that wrote the file
+	Entries map[string]lookupCacheEntry `json:"entries"`
+}
+
+// lookupCacheEntry is the cached library lookup of a single album
+type lookupCacheEntry struct {
+	Owned     bool      `json:"owned"`
+	By        string    `json:"by,omitempty"`      // how an owned album was matched
+	ID        string    `json:"id,omitempty"`      // library album ID of an owned album
+	Songs     int       `json:"songs,omitempty"`   // songs of an owned album in the library
+	Tracks    int       `json:"tracks,omitempty"`  // tracks of an owned album on Last.fm
+	Counted   bool      `json:"counted,omitempty"` // whether Songs and Tracks were compared by a TrackCountChecker
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// defaultCachePath returns the lookup cache location inside the user's cache directory
+// ($XDG_CACHE_HOME/album2buy on Linux)
+func defaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "album2buy", "lookups.json"), nil
+}
+
+// CachedChecker remembers library lookups on disk so that later runs only ask the
+// server about new or expired albums. Owned and missing albums expire separately,
+// as a missing album can be bought at any time; a TTL of 0 disables caching of that status.
+type CachedChecker struct {
+	checker    AlbumChecker
+	path       string
+	server     string
+	matcher    string
+	ownedTTL   time.Duration
+	missingTTL time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]lookupCacheEntry
+	dirty   bool
+	hits    int
+	misses  int
+}
+
+// NewCachedChecker wraps checker with the cache stored at path. Entries recorded
+// for a different server or under a different matcher fingerprint are discarded;
+// an unreadable cache file is reported and replaced by an empty cache.
+func NewCachedChecker(checker AlbumChecker, path, server, matcher string, ownedTTL, missingTTL time.Duration) (*CachedChecker, error) {
+	c := &CachedChecker{
+		checker:    checker,
+		path:       path,
+		server:     server,
+		matcher:    matcher,
+		ownedTTL:   ownedTTL,
+		missingTTL: missingTTL,
+		now:        time.Now,
+		entries:    make(map[string]lookupCacheEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("reading lookup cache: %w", err)
+	}
+
+	var file lookupCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return c, fmt.Errorf("parsing lookup cache %s: %w", path, err)
+	}
+	if file.Version == lookupCacheVersion && file.Server == server && file.Matcher == matcher && file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c, nil
+}
+
+// HasAlbum answers from the cache while the entry is fresh and asks the wrapped
+// checker otherwise; failed lookups are not cached
+func (c *CachedChecker) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	match, err := c.MatchAlbum(ctx, album)
+	return match.Owned, err
+}
+
+// MatchAlbum is HasAlbum, also telling how an owned album was matched
+func (c *CachedChecker) MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error) {
+	key := albumKey(album.Artist.Name, album.Name)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && c.fresh(entry) {
+		c.hits++
+		c.mu.Unlock()
+		return AlbumMatch{Owned: entry.Owned, By: entry.By, ID: entry.ID, Songs: entry.Songs}, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	match, err := matchAlbum(ctx, c.checker, album)
+	if err != nil {
+		return AlbumMatch{}, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = lookupCacheEntry{Owned: match.Owned, By: match.By, ID: match.ID, Songs: match.Songs, CheckedAt: c.now().UTC()}
+	c.dirty = true
+	c.mu.Unlock()
+	return match, nil
+}
+
+// TrackCounts returns the song and track counts remembered for an owned album, and whether
+// there are any
+func (c *CachedChecker) TrackCounts(album Album) (songs, tracks int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[albumKey(album.Artist.Name, album.Name)]
+	if !ok || !entry.Owned || !entry.Counted || !c.fresh(entry) {
+		return 0, 0, false
+	}
+	return entry.Songs, entry.Tracks, true
+}
+
+// RememberTrackCounts adds the song and track counts of an owned album to its entry, which
+// keeps them until the entry expires
+func (c *CachedChecker) RememberTrackCounts(album Album, songs, tracks int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := albumKey(album.Artist.Name, album.Name)
+	entry, ok := c.entries[key]
+	if !ok || !entry.Owned {
+		return
+	}
+	entry.Songs, entry.Tracks, entry.Counted = songs, tracks, true
+	c.entries[key] = entry
+	c.dirty = true
+}
+
+// fresh reports whether a cached entry is still within its TTL
+func (c *CachedChecker) fresh(entry lookupCacheEntry) bool {
+	ttl := c.missingTTL
+	if entry.Owned {
+		ttl = c.ownedTTL
+	}
+	return c.now().Sub(entry.CheckedAt) < ttl
+}
+
+// Stats returns how many lookups were answered from the cache and how many went to the server
+func (c *CachedChecker) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Save writes the cache back to disk if it changed, dropping expired entries.
+// The file is replaced atomically so an interrupted run never leaves a truncated cache.
+func (c *CachedChecker) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	for key, entry := range c.entries {
+		if !c.fresh(entry) {
+			delete(c.entries, key)
+		}
+	}
+
+	data, err := json.Marshal(lookupCacheFile{Version: lookupCacheVersion, Server: c.server, Matcher: c.matcher, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, data, 0o600); err != nil {
+		return fmt.Errorf("writing lookup cache: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// clearLookupCache removes the cache file at path, if there is one
+func clearLookupCache(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("clearing lookup cache: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place,
+// creating the parent directory if needed. The file gets the given permissions.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChecker is an AlbumChecker that owns a fixed set of albums and counts its lookups
+type fakeChecker struct {
+	mu      sync.Mutex
+	owned   map[string]bool
+	err     error
+	lookups int
+}
+
+func (f *fakeChecker) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	return f.owned[album.Name], f.err
+}
+
+func mustHaveAlbum(t *testing.T, checker AlbumChecker, name string) bool {
+	t.Helper()
+	owned, err := checker.HasAlbum(context.Background(), testAlbum("Artist", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return owned
+}
+
+func TestCachedCheckerPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "album2buy", "lookups.json")
+	inner := &fakeChecker{owned: map[string]bool{"Owned": true}}
+
+	cache, err := NewCachedChecker(inner, path, "https://music.example.com", "", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mustHaveAlbum(t, cache, "Owned") || mustHaveAlbum(t, cache, "Missing") {
+		t.Fatal("Unexpected lookup results")
+	}
+	mustHaveAlbum(t, cache, "owned")
+	if inner.lookups != 2 {
+		t.Errorf("Expected 2 server lookups, got %d", inner.lookups)
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %d and %d", hits, misses)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new run answers from the file without asking the server
+	inner = &fakeChecker{}
+	cache, err = NewCachedChecker(inner, path, "https://music.example.com", "", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mustHaveAlbum(t, cache, "Owned") || mustHaveAlbum(t, cache, "Missing") {
+		t.Error("Expected cached lookup results")
+	}
+	if inner.lookups != 0 {
+		t.Errorf("Expected no server lookups, got %d", inner.lookups)
+	}
+}
+
+func TestCachedCheckerSeparateTTLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	inner := &fakeChecker{owned: map[string]bool{"Owned": true}}
+
+	cache, err := NewCachedChecker(inner, path, "server", "", 30*24*time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return start }
+
+	mustHaveAlbum(t, cache, "Owned")
+	mustHaveAlbum(t, cache, "Missing")
+
+	// Two days later the missing album has expired but the owned one has not
+	cache.now = func() time.Time { return start.Add(48 * time.Hour) }
+	inner.lookups = 0
+	mustHaveAlbum(t, cache, "Owned")
+	mustHaveAlbum(t, cache, "Missing")
+	if inner.lookups != 1 {
+		t.Errorf("Expected only the missing album to be looked up again, got %d lookups", inner.lookups)
+	}
+}
+
+func TestCachedCheckerZeroTTLDisablesStatus(t *testing.T) {
+	inner := &fakeChecker{owned: map[string]bool{"Owned": true}}
+	cache, err := NewCachedChecker(inner, filepath.Join(t.TempDir(), "lookups.json"), "server", "", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		mustHaveAlbum(t, cache, "Owned")
+		mustHaveAlbum(t, cache, "Missing")
+	}
+	if inner.lookups != 3 {
+		t.Errorf("Expected missing albums to bypass the cache, got %d lookups", inner.lookups)
+	}
+}
+
+func TestCachedCheckerDoesNotCacheErrors(t *testing.T) {
+	inner := &fakeChecker{err: errors.New("server down")}
+	cache, err := NewCachedChecker(inner, filepath.Join(t.TempDir(), "lookups.json"), "server", "", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if _, err := cache.HasAlbum(context.Background(), testAlbum("Artist", "Album")); err == nil {
+			t.Error("Expected lookup error")
+		}
+	}
+	if inner.lookups != 2 {
+		t.Errorf("Expected failed lookups to be retried, got %d lookups", inner.lookups)
+	}
+}
+
+func TestCachedCheckerOtherServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	cache, err := NewCachedChecker(&fakeChecker{}, path, "https://one.example.com", "", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveAlbum(t, cache, "Album")
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &fakeChecker{}
+	cache, err = NewCachedChecker(inner, path, "https://two.example.com", "", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveAlbum(t, cache, "Album")
+	if inner.lookups != 1 {
+		t.Errorf("Expected entries of another server to be discarded, got %d lookups", inner.lookups)
+	}
+}
+
+func TestCachedCheckerOtherMatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	exact := (&Matcher{}).Fingerprint()
+	cache, err := NewCachedChecker(&fakeChecker{}, path, "server", exact, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveAlbum(t, cache, "Album")
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		fingerprint string
+		lookups     int
+	}{
+		{exact, 0},
+		{(&Matcher{Threshold: 0.9}).Fingerprint(), 1},
+	} {
+		inner := &fakeChecker{}
+		cache, err = NewCachedChecker(inner, path, "server", tt.fingerprint, time.Hour, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveAlbum(t, cache, "Album")
+		if inner.lookups != tt.lookups {
+			t.Errorf("Fingerprint %s: expected %d lookups, got %d", tt.fingerprint, tt.lookups, inner.lookups)
+		}
+	}
+}
+
+func TestCachedCheckerCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewCachedChecker(&fakeChecker{}, path, "server", "", time.Hour, time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "parsing lookup cache") {
+		t.Errorf("Expected parse error, got: %v", err)
+	}
+	if cache == nil {
+		t.Fatal("Expected an empty cache despite the error")
+	}
+
+	mustHaveAlbum(t, cache, "Album")
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCachedChecker(&fakeChecker{}, path, "server", "", time.Hour, time.Hour); err != nil {
+		t.Errorf("Expected the corrupt file to be replaced, got: %v", err)
+	}
+}
+
+func TestClearLookupCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clearLookupCache(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected cache file to be removed, got: %v", err)
+	}
+	if err := clearLookupCache(path); err != nil {
+		t.Errorf("Clearing a missing cache should not fail: %v", err)
+	}
+}
+
+func TestDefaultCachePathUsesXDG(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+
+	path, err := defaultCachePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "album2buy", "lookups.json") {
+		t.Errorf("Unexpected cache path %s", path)
+	}
+}
+
+// fakeMatchChecker is a fakeChecker that tells albums with an MBID to be matched by it, as a library album of 7 songs
+type fakeMatchChecker struct {
+	fakeChecker
+}
+
+func (f *fakeMatchChecker) MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error) {
+	owned, err := f.HasAlbum(ctx, album)
+	switch {
+	case !owned:
+		return AlbumMatch{}, err
+	case album.MBID != "":
+		return AlbumMatch{Owned: true, By: matchByMBID, ID: "al-1", Songs: 7}, err
+	default:
+		return AlbumMatch{Owned: true, By: matchByName}, err
+	}
+}
+
+func TestCachedCheckerRemembersMatchMethod(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	inner := &fakeMatchChecker{fakeChecker{owned: map[string]bool{"Tagged": true, "Untagged": true}}}
+	tagged := testAlbum("Artist", "Tagged")
+	tagged.MBID = "b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"
+
+	for range 2 {
+		cache, err := NewCachedChecker(inner, path, "server", "", time.Hour, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match, err := cache.MatchAlbum(context.Background(), tagged); err != nil || match != (AlbumMatch{Owned: true, By: matchByMBID, ID: "al-1", Songs: 7}) {
+			t.Errorf("Expected a match by MusicBrainz ID of 7 songs, got %+v (%v)", match, err)
+		}
+		if match, err := cache.MatchAlbum(context.Background(), testAlbum("Artist", "Untagged")); err != nil || match.By != matchByName {
+			t.Errorf("Expected a match by name, got %+v (%v)", match, err)
+		}
+		if err := cache.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.lookups != 2 {
+		t.Errorf("Expected the second run to be answered from the cache, got %d lookups", inner.lookups)
+	}
+
+	// Caches written before match methods and song counts were cached are discarded
+	if err := os.WriteFile(path, []byte(`{"version":1,"server":"server","entries":{"artist\u0000old":{"owned":true,"checked_at":"`+
+		time.Now().UTC().Format(time.RFC3339)+`"}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	inner = &fakeMatchChecker{}
+	cache, err := NewCachedChecker(inner, path, "server", "", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, err := cache.MatchAlbum(context.Background(), testAlbum("Artist", "Old")); err != nil || match.Owned || inner.lookups != 1 {
+		t.Errorf("Expected an old cache to be discarded, got %+v (%v) after %d lookups", match, err, inner.lookups)
+	}
+}
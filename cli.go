@@ -0,0 +1,930 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command describes a CLI subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, cfg *Config, args []string) error
+}
+
+// commands returns every subcommand in the order they are listed in the usage text
+func commands() []command {
+	return []command{
+		{name: "recommend", summary: "recommend top Last.fm albums missing from the library (default)", run: runRecommend},
+		{name: "tracks", summary: "recommend the albums covering the most plays of top Last.fm tracks missing from the library", run: runTracks},
+		{name: "triage", summary: "walk through the missing albums one by one and decide what to do with each", run: runTriage},
+		{name: "check", args: "<artist> <album>", summary: "check whether a single album is in the library", run: runCheck},
+		{name: "explain", args: "<artist> <album>", summary: "show how an album is looked up in the library and why each search result matches or not", run: runExplain},
+		{name: "ignore", args: "[list|add|remove|prune] ...", summary: "list, add, remove or prune ignore rules", run: runIgnore},
+		{name: "aliases", args: "[list|suggest]", summary: "list artist aliases, or suggest aliases for artists missing from the library", run: runAliases},
+		{name: "stats", summary: "report how many top albums are in the library", run: runStats},
+		{name: "config", summary: "show the effective configuration and where each value came from", run: runConfig},
+	}
+}
+
+// usageError marks errors caused by invalid command-line usage
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// run parses the command line and executes the selected subcommand, returning the process exit code
+func run(args []string) int {
+	name := "recommend"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	var cmd *command
+	for _, c := range commands() {
+		if c.name == name {
+			cmd = &c
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	fs, flagValues, configPath := newFlagSet(*cmd)
+	positional, err := parseInterspersed(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(flagValues, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	if err := cmd.run(context.Background(), cfg, positional); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			fs.Usage()
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// settingFlag is a flag.Value that records a setting given on the command line
+type settingFlag struct {
+	key    string
+	isBool bool
+	values map[string]string
+}
+
+func (f *settingFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return f.values[f.key]
+}
+
+func (f *settingFlag) Set(value string) error {
+	f.values[f.key] = value
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// newFlagSet creates the flag set for a subcommand with a flag for every setting.
+// Flags that are given end up in the returned map keyed by setting key.
+func newFlagSet(cmd command) (*flag.FlagSet, map[string]string, *string) {
+	values := map[string]string{}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	configPath := fs.String("config", "", "path to the config file (default $"+configPathEnv+" or "+defaultConfigPath()+")")
+	for _, s := range settings {
+		usage := s.Usage + " (" + s.Key + ")"
+		fs.Var(&settingFlag{key: s.Key, isBool: s.Bool, values: values}, s.Flag, usage)
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: album2buy %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	return fs, values, configPath
+}
+
+// parseInterspersed parses flags that may appear before, between or after positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// printUsage writes the top-level help text
+func printUsage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: album2buy [command] [flags] [args]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %s %s\t%s\n", c.name, c.args, c.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Flags take precedence over environment variables, which take precedence over the config file.")
+	fmt.Fprintln(out, "Run 'album2buy <command> -h' to list the flags of a command.")
+}
+
+// newClients creates the API clients for the resolved configuration
+func newClients(cfg *Config) (*LastFMClient, *SubsonicClient, error) {
+	matcher, err := newMatcher(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpClient := newHTTPClient(cfg.InsecureSkipVerify)
+	lastFMClient := NewLastFMClient(httpClient, cfg.LastFMAPIKey)
+	subsonicClient := NewSubsonicClient(httpClient, cfg.SubsonicServer, cfg.SubsonicUser, cfg.SubsonicPass)
+	subsonicClient.matcher = matcher
+	return lastFMClient, subsonicClient, nil
+}
+
+// newMatcher creates the name matcher for the resolved configuration, reading the edition rules and alias files if set
+func newMatcher(cfg *Config) (*Matcher, error) {
+	var rules []string
+	if cfg.EditionRulesFile != "" {
+		var err error
+		if rules, err = loadEditionRules(cfg.EditionRulesFile); err != nil {
+			return nil, err
+		}
+	}
+	normalizer, err := NewNormalizer(!cfg.NoEditionDefaults, rules)
+	if err != nil {
+		return nil, err
+	}
+	normalizer.EnableSteps(cfg.NormalizeSteps)
+
+	matcher := &Matcher{Threshold: cfg.MatchThreshold, Normalizer: normalizer}
+	if cfg.AliasFile != "" {
+		if matcher.Aliases, err = loadArtistAliases(cfg.AliasFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Verbose {
+		matcher.Log = os.Stderr
+	}
+	return matcher, nil
+}
+
+// newAlbumChecker returns the library lookup to use for a run, which compares the track
+// counts of owned albums unless PARTIAL_ALBUMS counts partial albums as owned. The
+// returned done function must be called once the run is over.
+func newAlbumChecker(ctx context.Context, cfg *Config, lastFMClient *LastFMClient, subsonicClient *SubsonicClient) (checker AlbumChecker, done func(), err error) {
+	checker, done, err = newLibraryChecker(ctx, cfg, subsonicClient)
+	if err != nil || cfg.PartialAlbums == partialOwned {
+		return checker, done, err
+	}
+
+	tracks := NewTrackCountChecker(checker, lastFMClient, subsonicClient)
+	return tracks, func() {
+		done()
+		if failed := tracks.Failed(); failed > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: could not compare track counts of %d albums, counted them as complete\n", failed)
+		}
+	}, nil
+}
+
+// newLibraryChecker returns the lookup of albums in the library: a snapshot of the
+// whole album list when LIBRARY_INDEX is set, or a search per album otherwise,
+// answered from the lookup cache where possible. The returned done function saves
+// the cache and must be called once the run is over.
+func newLibraryChecker(ctx context.Context, cfg *Config, subsonicClient *SubsonicClient) (checker AlbumChecker, done func(), err error) {
+	done = func() {}
+
+	// Without a user cache directory the run simply goes uncached
+	cachePath, _ := defaultCachePath()
+	if cfg.ClearCache && cachePath != "" {
+		if err := clearLookupCache(cachePath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cfg.LibraryIndex {
+		spinner := NewSpinner("Loading library index...")
+		spinner.Start()
+		index, err := LoadLibraryIndex(ctx, subsonicClient)
+		spinner.Stop()
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading library index: %w", err)
+		}
+		if cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Indexed %d library albums\n", index.Len())
+		}
+		return index, done, nil
+	}
+
+	if cfg.NoCache || cachePath == "" {
+		return subsonicClient, done, nil
+	}
+
+	cache, err := NewCachedChecker(subsonicClient, cachePath, cfg.SubsonicServer, subsonicClient.matcher.Fingerprint(), cfg.CacheOwnedTTL, cfg.CacheMissingTTL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	done = func() {
+		if err := cache.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if cfg.Verbose {
+			hits, misses := cache.Stats()
+			fmt.Fprintf(os.Stderr, "Lookup cache: %d hits, %d server lookups\n", hits, misses)
+		}
+	}
+	return cache, done, nil
+}
+
+// runRecommend prints the top Last.fm albums that are missing from the library
+func runRecommend(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "recommend takes no arguments"}
+	}
+	if err := errors.Join(cfg.requireLastFM(), cfg.requireSubsonic()); err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	checker, done, err := newAlbumChecker(ctx, cfg, lastFMClient, subsonicClient)
+	if err != nil {
+		return err
+	}
+	defer done()
+	pager := lastFMClient.NewTopAlbumPager(cfg.LastFMUser, cfg.LastFMPeriod, cfg.LastFMMaxAlbums)
+
+	// Collect extra candidates when scoring can reorder them
+	candidates := cfg.MaxRecommendations
+	if candidates > 0 && cfg.ScoreWeights.reorders() {
+		candidates *= scoreCandidateFactor
+	}
+
+	result, err := findMissingAlbums(ctx, checker, pager, cfg, candidates)
+	if err != nil {
+		return fmt.Errorf("fetching Last.fm albums: %w", err)
+	}
+
+	spinner := NewSpinner("Scoring recommendations...")
+	spinner.Start()
+	err = newScorer(cfg, lastFMClient, subsonicClient).Score(ctx, result.Missing)
+	spinner.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: scoring incomplete: %v\n", err)
+	}
+	if cfg.MaxRecommendations > 0 && len(result.Missing) > cfg.MaxRecommendations {
+		result.Missing = result.Missing[:cfg.MaxRecommendations]
+	}
+
+	report := newReport(cfg, result)
+	recordHistory(ctx, cfg, report, checker)
+	return writeReport(os.Stdout, cfg.OutputFormat, report)
+}
+
+// recordHistory adds the run to the recommendation history, first comparing it with the
+// previous run when --diff is set. Problems with the history are reported as warnings.
+func recordHistory(ctx context.Context, cfg *Config, report *Report, checker AlbumChecker) {
+	path, err := historyPath(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no history location: %v\n", err)
+		return
+	}
+	history, err := LoadHistory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+
+	if cfg.Diff {
+		if err := diffReport(ctx, report, history, checker); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not check previous recommendations: %v\n", err)
+		}
+	}
+
+	history.Record(report)
+	if err := history.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// runTracks checks the top Last.fm tracks against the library and prints the albums that
+// cover the most plays of the missing ones
+func runTracks(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "tracks takes no arguments"}
+	}
+	if err := errors.Join(cfg.requireLastFM(), cfg.requireSubsonic()); err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	checker, done, err := newLibraryChecker(ctx, cfg, subsonicClient)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	spinner := NewSpinner("Fetching top tracks...")
+	spinner.Start()
+	tracks, err := lastFMClient.GetTopTracks(ctx, cfg.LastFMUser, cfg.LastFMPeriod, cfg.LastFMMaxTracks)
+	spinner.Stop()
+	if err != nil {
+		return fmt.Errorf("fetching Last.fm tracks: %w", err)
+	}
+
+	result, err := findTrackAlbums(ctx, subsonicClient, checker, lastFMClient, tracks, cfg, cfg.MaxRecommendations)
+	if err != nil {
+		return err
+	}
+	if cfg.OutputFormat == "text" {
+		return printTrackAlbums(os.Stdout, result, cfg.LastFMPeriod)
+	}
+	return writeReport(os.Stdout, cfg.OutputFormat, newTrackReport(cfg, result))
+}
+
+// runTriage walks through the missing albums interactively, fetching more from Last.fm
+// whenever the current batch has been decided
+func runTriage(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "triage takes no arguments"}
+	}
+	if err := errors.Join(cfg.requireLastFM(), cfg.requireSubsonic()); err != nil {
+		return err
+	}
+
+	path, err := historyPath(cfg)
+	if err != nil {
+		return fmt.Errorf("no history location: %w", err)
+	}
+	history, err := LoadHistory(path)
+	if err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	checker, done, err := newAlbumChecker(ctx, cfg, lastFMClient, subsonicClient)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	pager := lastFMClient.NewTopAlbumPager(cfg.LastFMUser, cfg.LastFMPeriod, cfg.LastFMMaxAlbums)
+	scanner := newAlbumScanner(checker, pager, cfg)
+	result := &CheckResult{}
+	next := func(ctx context.Context) (*Album, error) {
+		if len(result.Missing) == 0 && !scanner.Exhausted() {
+			if err := scanner.Scan(ctx, result, triageBatchSize); err != nil {
+				return nil, fmt.Errorf("fetching Last.fm albums: %w", err)
+			}
+		}
+		if len(result.Missing) == 0 {
+			return nil, nil
+		}
+		album := result.Missing[0]
+		result.Missing = result.Missing[1:]
+		return album, nil
+	}
+
+	session := &triageSession{
+		keys:       newKeyReader(os.Stdin, os.Stdout),
+		out:        os.Stdout,
+		next:       next,
+		history:    history,
+		ignoreFile: cfg.IgnoreFile,
+		now:        time.Now,
+		open:       openURL,
+	}
+	return session.run(ctx)
+}
+
+// runCheck reports whether a single album is present in the library
+func runCheck(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) != 2 {
+		return &usageError{msg: "check expects an artist and an album name"}
+	}
+	if err := cfg.requireSubsonic(); err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	album := Album{Name: args[1]}
+	album.Artist.Name = args[0]
+
+	var checker AlbumChecker = subsonicClient
+	if cfg.PartialAlbums != partialOwned {
+		if err := cfg.require("LASTFM_API_KEY"); err != nil {
+			return err
+		}
+		checker = NewTrackCountChecker(subsonicClient, lastFMClient, subsonicClient)
+	}
+	match, err := matchAlbum(ctx, checker, album)
+	if err != nil {
+		return fmt.Errorf("checking album: %w", err)
+	}
+
+	switch {
+	case match.Partial():
+		rec := Recommendation{OwnedTracks: match.Songs, Tracks: match.Tracks}
+		fmt.Printf("Partly in library: %s - %s (%s)\n", album.Artist.Name, album.Name, tracksText(rec))
+	case match.Owned:
+		fmt.Printf("In library: %s - %s\n", album.Artist.Name, album.Name)
+	default:
+		fmt.Printf("Missing: %s - %s\n", album.Artist.Name, album.Name)
+	}
+	return nil
+}
+
+// runExplain looks up a single album like check does and shows every step: the names as
+// they are compared, the search results and the rule that accepted or rejected each of them
+func runExplain(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) != 2 {
+		return &usageError{msg: "explain expects an artist and an album name"}
+	}
+	if err := cfg.requireSubsonic(); err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	album := Album{Name: args[1]}
+	album.Artist.Name = args[0]
+
+	// The MusicBrainz ID only comes from Last.fm, so without an API key albums match by name alone
+	if cfg.LastFMAPIKey != "" {
+		info, err := lastFMClient.GetAlbumInfo(ctx, album.Artist.Name, album.Name, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: no MusicBrainz ID from Last.fm: %v\n", err)
+		} else {
+			album.MBID = info.MBID
+		}
+	}
+
+	// Searches made before a failing one are still worth showing
+	searches, _, err := subsonicClient.searchLibrary(ctx, album)
+	printExplanation(os.Stdout, album, subsonicClient.matcher, searches)
+	if err != nil {
+		return fmt.Errorf("searching library: %w", err)
+	}
+	return nil
+}
+
+// ignoreCommands are the subcommands of the ignore command
+var ignoreCommands = map[string]func(ctx context.Context, cfg *Config, ignoreList *IgnoreList, args []string) error{
+	"list":   runIgnoreList,
+	"add":    runIgnoreAdd,
+	"remove": runIgnoreRemove,
+	"prune":  runIgnorePrune,
+}
+
+// runIgnore manages the ignore file. Without a subcommand it lists the rules, and
+// arguments that are not a subcommand are added, as before subcommands existed.
+func runIgnore(ctx context.Context, cfg *Config, args []string) error {
+	if cfg.IgnoreFile == "" {
+		return fmt.Errorf("no ignore file configured (set IGNORE_FILE or --ignore-file)")
+	}
+
+	sub := runIgnoreList
+	if len(args) > 0 {
+		if run, ok := ignoreCommands[args[0]]; ok {
+			sub, args = run, args[1:]
+		} else {
+			sub = runIgnoreAdd
+		}
+	}
+	return sub(ctx, cfg, loadIgnoreList(cfg.IgnoreFile), args)
+}
+
+// runIgnoreList prints the rules of the ignore file with their line numbers
+func runIgnoreList(ctx context.Context, cfg *Config, ignoreList *IgnoreList, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "ignore list takes no arguments"}
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, rule := range ignoreList.Rules {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", rule.Line, rule.Kind, rule.Value, snoozeText(&rule, now), rule.Note)
+	}
+	return w.Flush()
+}
+
+// runIgnoreAdd appends rules to the ignore file. Each argument is a rule line as it
+// would appear in the file, or starts with the number of an album in the latest
+// recommendations, which stands for its Last.fm URL.
+func runIgnoreAdd(ctx context.Context, cfg *Config, ignoreList *IgnoreList, args []string) error {
+	if len(args) == 0 {
+		return &usageError{msg: "ignore add expects a recommendation number, a Last.fm URL or a rule"}
+	}
+
+	var rules []*IgnoreRule
+	for _, arg := range args {
+		line, err := resolveRecommendationNumber(cfg, arg)
+		if err != nil {
+			return err
+		}
+		rule, err := parseIgnoreRule(line)
+		if err != nil {
+			return &usageError{msg: fmt.Sprintf("invalid ignore rule %q: %v", arg, err)}
+		}
+		if rule == nil {
+			return &usageError{msg: fmt.Sprintf("empty ignore rule %q", arg)}
+		}
+		rules = append(rules, rule)
+	}
+
+	var added []string
+	for _, rule := range rules {
+		if rule.Kind == ignoreURL && ignoreList.HasURL(rule.Value) {
+			fmt.Printf("Already ignored: %s\n", rule.Value)
+			continue
+		}
+		ignoreList.Rules = append(ignoreList.Rules, *rule)
+		added = append(added, rule.String())
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	err := editIgnoreFile(cfg.IgnoreFile, func(lines []string) []string {
+		return append(lines, added...)
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range added {
+		fmt.Printf("Ignored: %s\n", line)
+	}
+	return nil
+}
+
+// resolveRecommendationNumber replaces a leading recommendation number in arg with the
+// Last.fm URL of that album in the latest recorded run; other arguments are returned as is.
+// The number is the position in the list, as the text output numbers it, not the Last.fm
+// rank of the JSON and CSV output; a position that is the rank of another album is rejected.
+func resolveRecommendationNumber(cfg *Config, arg string) (string, error) {
+	number, rest, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return arg, nil
+	}
+
+	path, err := historyPath(cfg)
+	if err != nil {
+		return "", err
+	}
+	history, err := LoadHistory(path)
+	if err != nil {
+		return "", err
+	}
+	previous := history.Previous(cfg.LastFMUser, cfg.LastFMPeriod)
+	if previous == nil {
+		return "", fmt.Errorf("no recorded recommendations for %s (%s) to pick album %d from", cfg.LastFMUser, lastFMPeriods[cfg.LastFMPeriod], n)
+	}
+	if n < 1 || n > len(previous.Recommendations) {
+		return "", &usageError{msg: fmt.Sprintf("album %d is not in the latest recommendations (1-%d)", n, len(previous.Recommendations))}
+	}
+
+	rec := previous.Recommendations[n-1]
+	for _, other := range previous.Recommendations {
+		if other.Rank == n && rec.Rank != n {
+			return "", &usageError{msg: fmt.Sprintf("album %d is ambiguous: it is %s - %s, but #%d in your top albums is %s - %s; give the Last.fm URL instead",
+				n, rec.Artist, rec.Album, n, other.Artist, other.Album)}
+		}
+	}
+	if rec.URL == "" {
+		return "", fmt.Errorf("album %d (%s - %s) has no Last.fm URL", n, rec.Artist, rec.Album)
+	}
+	return strings.TrimSpace(rec.URL + " " + rest), nil
+}
+
+// runIgnoreRemove deletes rules from the ignore file, given by line number, Last.fm URL or rule text
+func runIgnoreRemove(ctx context.Context, cfg *Config, ignoreList *IgnoreList, args []string) error {
+	if len(args) == 0 {
+		return &usageError{msg: "ignore remove expects a line number, a Last.fm URL or a rule"}
+	}
+
+	remove := map[int]bool{}
+	var removed []string
+	for _, arg := range args {
+		found := false
+		for _, rule := range ignoreList.Rules {
+			if strconv.Itoa(rule.Line) == arg || rule.Value == arg || rule.String() == arg {
+				if !remove[rule.Line] {
+					removed = append(removed, rule.String())
+				}
+				remove[rule.Line] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no ignore rule matches %q", arg)
+		}
+	}
+
+	err := editIgnoreFile(cfg.IgnoreFile, func(lines []string) []string {
+		return removeLines(lines, remove)
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range removed {
+		fmt.Printf("Removed: %s\n", line)
+	}
+	return nil
+}
+
+// runIgnorePrune drops URL rules for albums that have since entered the library or are not
+// among the all-time Last.fm top albums, as well as expired snoozes. With --dry-run it only
+// lists them.
+func runIgnorePrune(ctx context.Context, cfg *Config, ignoreList *IgnoreList, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "ignore prune takes no arguments"}
+	}
+	if err := errors.Join(cfg.requireLastFM(), cfg.requireSubsonic()); err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	// Every album ever played counts, whatever the period and album limit of recommendations
+	spinner := NewSpinner("Fetching all-time top albums from Last.fm...")
+	spinner.Start()
+	topAlbums, err := lastFMClient.GetTopAlbums(ctx, cfg.LastFMUser, "overall", 0)
+	spinner.Stop()
+	if err != nil {
+		return fmt.Errorf("fetching Last.fm albums: %w", err)
+	}
+
+	remove, removed := pruneIgnoreRules(ctx, ignoreList, topAlbums, subsonicClient, time.Now())
+	return removePrunedRules(cfg.IgnoreFile, remove, removed, cfg.DryRun)
+}
+
+// removePrunedRules removes the pruned lines from the ignore file and reports each removal;
+// with dryRun it only reports what would be removed
+func removePrunedRules(ignoreFile string, remove map[int]bool, removed []string, dryRun bool) error {
+	if len(remove) == 0 {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+	if dryRun {
+		for _, line := range removed {
+			fmt.Printf("Would remove: %s\n", line)
+		}
+		return nil
+	}
+
+	err := editIgnoreFile(ignoreFile, func(lines []string) []string {
+		return removeLines(lines, remove)
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range removed {
+		fmt.Printf("Removed: %s\n", line)
+	}
+	return nil
+}
+
+// pruneIgnoreRules selects the rules that no longer serve a purpose: expired snoozes, and URL
+// rules for albums that are not among topAlbums, the user's all-time top albums, or that
+// checker finds in the library. It returns the line numbers to remove together with a
+// description of each removal.
+func pruneIgnoreRules(ctx context.Context, ignoreList *IgnoreList, topAlbums []Album, checker AlbumChecker, now time.Time) (map[int]bool, []string) {
+	top := make(map[string]Album, len(topAlbums))
+	for _, album := range topAlbums {
+		top[album.URL] = album
+	}
+
+	remove := map[int]bool{}
+	var removed []string
+	for _, rule := range ignoreList.Rules {
+		reason := ""
+		if rule.Snoozed() && !rule.Active(now) {
+			reason = "snooze expired"
+		} else if rule.Kind == ignoreURL {
+			album, ok := top[rule.Value]
+			if !ok {
+				reason = "not in all-time top albums"
+			} else if owned, err := checker.HasAlbum(ctx, album); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not check '%s - %s': %v\n", album.Artist.Name, album.Name, err)
+			} else if owned {
+				reason = "now in library"
+			}
+		}
+
+		if reason != "" {
+			remove[rule.Line] = true
+			removed = append(removed, fmt.Sprintf("%s (%s)", rule.String(), reason))
+		}
+	}
+	return remove, removed
+}
+
+// snoozeText describes the snooze state of an ignore rule
+func snoozeText(rule *IgnoreRule, now time.Time) string {
+	switch {
+	case !rule.Snoozed():
+		return ""
+	case rule.Active(now):
+		return "snoozed until " + rule.SnoozeUntil.Format(time.DateOnly)
+	default:
+		return "snooze expired " + rule.SnoozeUntil.Format(time.DateOnly)
+	}
+}
+
+// runAliases lists the artist aliases, or suggests new ones for the artists of the top albums
+// that have no album in the library under their own name but a similar name in the library
+func runAliases(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "list" && args[0] != "suggest") {
+		return &usageError{msg: "aliases expects list or suggest"}
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		if cfg.AliasFile == "" {
+			return fmt.Errorf("no alias file configured (set ALIAS_FILE or --alias-file)")
+		}
+		aliases, err := loadArtistAliases(cfg.AliasFile)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, alias := range aliases {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", alias.Line, alias.Artist, strings.Join(alias.Library, " | "), alias.Note)
+		}
+		return w.Flush()
+	}
+
+	if err := errors.Join(cfg.requireLastFM(), cfg.requireSubsonic()); err != nil {
+		return err
+	}
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+
+	spinner := NewSpinner("Fetching top albums and library artists...")
+	spinner.Start()
+	topAlbums, err := lastFMClient.GetTopAlbums(ctx, cfg.LastFMUser, cfg.LastFMPeriod, cfg.LastFMMaxAlbums)
+	var artists []SubsonicArtist
+	if err == nil {
+		artists, err = subsonicClient.GetArtists(ctx)
+	}
+	spinner.Stop()
+	if err != nil {
+		return err
+	}
+
+	suggestions := suggestAliases(topAlbums, artists, subsonicClient.matcher)
+	if len(suggestions) == 0 {
+		fmt.Println("No aliases to suggest")
+		return nil
+	}
+	fmt.Println("# Suggested aliases, check them before adding them to the alias file")
+	for _, s := range suggestions {
+		albums := fmt.Sprintf("%d top albums", s.Albums)
+		if s.Albums == 1 {
+			albums = "1 top album"
+		}
+		alias := ArtistAlias{Artist: s.Artist, Library: []string{s.Library}, Note: fmt.Sprintf("similarity %.2f, %s", s.Score, albums)}
+		fmt.Println(alias)
+	}
+	return nil
+}
+
+// runStats checks every top album and reports how much of it is in the library
+func runStats(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "stats takes no arguments"}
+	}
+	if err := errors.Join(cfg.requireLastFM(), cfg.requireSubsonic()); err != nil {
+		return err
+	}
+
+	lastFMClient, subsonicClient, err := newClients(cfg)
+	if err != nil {
+		return err
+	}
+	checker, done, err := newAlbumChecker(ctx, cfg, lastFMClient, subsonicClient)
+	if err != nil {
+		return err
+	}
+	defer done()
+	pager := lastFMClient.NewTopAlbumPager(cfg.LastFMUser, cfg.LastFMPeriod, cfg.LastFMMaxAlbums)
+
+	result, err := findMissingAlbums(ctx, checker, pager, cfg, 0)
+	if err != nil {
+		return fmt.Errorf("fetching Last.fm albums: %w", err)
+	}
+	printErrorStats(os.Stdout, result.Stats)
+
+	// Recommended partial albums are among the missing ones, but they are in the library
+	missing := len(result.Missing)
+	if cfg.PartialAlbums == partialRecommend {
+		missing -= len(result.Partial)
+	}
+	owned := result.Stats.Successful - missing
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Period:\t%s\n", lastFMPeriods[cfg.LastFMPeriod])
+	fmt.Fprintf(w, "Top albums:\t%d\n", result.Albums)
+	fmt.Fprintf(w, "Ignored:\t%d\n", result.Ignored)
+	fmt.Fprintf(w, "Snoozed:\t%d\n", result.Snoozed)
+	fmt.Fprintf(w, "Checked:\t%d\n", result.Stats.Total)
+	fmt.Fprintf(w, "In library:\t%d\n", owned)
+	fmt.Fprintf(w, "  by MusicBrainz ID:\t%d\n", result.Matches.MBID)
+	fmt.Fprintf(w, "  by name:\t%d\n", result.Matches.Name)
+	if cfg.PartialAlbums != partialOwned {
+		fmt.Fprintf(w, "  partly:\t%d\n", len(result.Partial))
+	}
+	fmt.Fprintf(w, "Missing:\t%d\n", missing)
+	fmt.Fprintf(w, "Failed:\t%d\n", result.Stats.Failed)
+	if result.Stats.Successful > 0 {
+		fmt.Fprintf(w, "Coverage:\t%.1f%%\n", float64(owned)/float64(result.Stats.Successful)*100)
+	}
+	return w.Flush()
+}
+
+// runConfig prints every setting with its effective value and source
+func runConfig(ctx context.Context, cfg *Config, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "config takes no arguments"}
+	}
+
+	if cfg.ConfigFile != "" {
+		fmt.Printf("Config file: %s\n\n", cfg.ConfigFile)
+	} else {
+		fmt.Printf("Config file: none\n\n")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, s := range settings {
+		value := cfg.Get(s.Key)
+		if s.Secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, value, cfg.Source(s.Key))
+	}
+	return w.Flush()
+}
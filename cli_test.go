@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout runs fn and returns everything it wrote to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	fn()
+	w.Close()
+	<-done
+	os.Stdout = oldStdout
+
+	return buf.String()
+}
+
+func TestParseInterspersedFlags(t *testing.T) {
+	cmd := command{name: "check"}
+	fs, values, configPath := newFlagSet(cmd)
+	fs.SetOutput(io.Discard)
+
+	args := []string{"--lastfm-user", "alice", "Artist", "--verbose", "Album", "--config", "/tmp/cfg", "--", "--not-a-flag"}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Artist", "Album", "--not-a-flag"}
+	if strings.Join(positional, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected positional %v, got %v", expected, positional)
+	}
+
+	if values["LASTFM_USER"] != "alice" {
+		t.Errorf("Expected LASTFM_USER flag value 'alice', got %q", values["LASTFM_USER"])
+	}
+	if values["VERBOSE"] != "true" {
+		t.Errorf("Expected boolean flag to be recorded as 'true', got %q", values["VERBOSE"])
+	}
+	if _, ok := values["SUBSONIC_USER"]; ok {
+		t.Error("Flags that were not given must not be recorded")
+	}
+	if *configPath != "/tmp/cfg" {
+		t.Errorf("Expected config path /tmp/cfg, got %s", *configPath)
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	isolateConfig(t)
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = oldStderr }()
+
+	if code := run([]string{"frobnicate"}); code != 2 {
+		t.Errorf("Expected exit code 2 for unknown command, got %d", code)
+	}
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv("LASTFM_API_KEY", "secret-key")
+
+	var code int
+	output := captureStdout(t, func() {
+		code = run([]string{"config", "--lastfm-user", "flag-user"})
+	})
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if strings.Contains(output, "secret-key") {
+		t.Error("Secret settings must be masked")
+	}
+	if !strings.Contains(output, "flag-user") || !strings.Contains(output, sourceFlag) {
+		t.Errorf("Expected flag value and source in output, got: %s", output)
+	}
+}
+
+func TestRunIgnoreCommand(t *testing.T) {
+	isolateConfig(t)
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	url := "https://www.last.fm/music/Artist/Album"
+
+	captureStdout(t, func() {
+		if code := run([]string{"ignore", "--ignore-file", ignoreFile, url, url}); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+
+	ignored := loadIgnoreList(ignoreFile).Rules
+	if len(ignored) != 1 || ignored[0].Value != url {
+		t.Errorf("Expected ignore file to contain %s once, got %v", url, ignored)
+	}
+
+	output := captureStdout(t, func() {
+		run([]string{"ignore", "--ignore-file", ignoreFile})
+	})
+	if fields := strings.Fields(output); len(fields) != 3 || fields[1] != ignoreURL || fields[2] != url {
+		t.Errorf("Expected ignore list to print the URL rule, got %q", output)
+	}
+}
+
+func TestRunIgnoreAddByNumber(t *testing.T) {
+	isolateConfig(t)
+	dir := t.TempDir()
+	ignoreFile := filepath.Join(dir, "ignore")
+	historyFile := filepath.Join(dir, "history.json")
+
+	history, err := LoadHistory(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{GeneratedAt: time.Now(), User: "alice", Period: "12month", Recommendations: []Recommendation{
+		{Rank: 1, Artist: "Dream Theater", Album: "Parasomnia", URL: "https://www.last.fm/music/Dream+Theater/Parasomnia"},
+		{Rank: 3, Artist: "Poppy", Album: "Zig", URL: "https://www.last.fm/music/Poppy/Zig"},
+		{Rank: 5, Artist: "Dream Theater", Album: "Awake", URL: "https://www.last.fm/music/Dream+Theater/Awake"},
+	}}
+	history.Record(report)
+	if err := history.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(ignoreFile, []byte("# my rules\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := []string{"--ignore-file", ignoreFile, "--history-file", historyFile, "--lastfm-user", "alice"}
+	output := captureStdout(t, func() {
+		args := append([]string{"ignore", "add", "2 snooze-until=2999-01-01 # after the tour", "artist: Jeremy Soule"}, flags...)
+		if code := run(args); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+	if !strings.Contains(output, "Ignored: https://www.last.fm/music/Poppy/Zig snooze-until=2999-01-01 # after the tour") {
+		t.Errorf("Expected the second recommendation to be ignored, got: %s", output)
+	}
+
+	content, err := os.ReadFile(ignoreFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# my rules\nhttps://www.last.fm/music/Poppy/Zig snooze-until=2999-01-01 # after the tour\nartist: Jeremy Soule\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected ignore file:\n%s", content)
+	}
+	if info, err := os.Stat(ignoreFile); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("Expected file permissions to be kept, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	captureStdout(t, func() {
+		if code := run(append([]string{"ignore", "add", "4"}, flags...)); code != 2 {
+			t.Errorf("Expected usage error for an unknown recommendation number, got %d", code)
+		}
+	})
+
+	// Album 3 of the list is #5 in the top albums, while #3 is album 2
+	cfg := &Config{HistoryFile: historyFile, LastFMUser: "alice", LastFMPeriod: "12month"}
+	if _, err := resolveRecommendationNumber(cfg, "3"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected a number that is also the rank of another album to be rejected, got: %v", err)
+	}
+}
+
+func TestRunIgnoreRemove(t *testing.T) {
+	isolateConfig(t)
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	content := "# keep this comment\nhttps://www.last.fm/music/A/One\nartist: B # note\nhttps://www.last.fm/music/A/Two\n"
+	if err := os.WriteFile(ignoreFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		if code := run([]string{"ignore", "remove", "--ignore-file", ignoreFile, "3", "https://www.last.fm/music/A/Two"}); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+	if !strings.Contains(output, "Removed: artist: B # note") {
+		t.Errorf("Expected removal to be reported, got: %s", output)
+	}
+
+	data, err := os.ReadFile(ignoreFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# keep this comment\nhttps://www.last.fm/music/A/One\n" {
+		t.Errorf("Unexpected ignore file:\n%s", data)
+	}
+
+	captureStdout(t, func() {
+		if code := run([]string{"ignore", "remove", "--ignore-file", ignoreFile, "https://www.last.fm/music/A/Nope"}); code != 1 {
+			t.Errorf("Expected error for an unknown rule, got %d", code)
+		}
+	})
+}
+
+func TestPruneIgnoreRules(t *testing.T) {
+	list, err := parseIgnoreList(strings.NewReader(`https://www.last.fm/music/A/Bought
+https://www.last.fm/music/A/Forgotten
+https://www.last.fm/music/A/Still+Unwanted
+artist: A
+https://www.last.fm/music/A/Later snooze-until=2025-01-01
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var topAlbums []Album
+	for _, top := range []struct{ name, url string }{
+		{"Bought", "https://www.last.fm/music/A/Bought"},
+		{"Still Unwanted", "https://www.last.fm/music/A/Still+Unwanted"},
+		{"Later", "https://www.last.fm/music/A/Later"},
+	} {
+		album := testAlbum("A", top.name)
+		album.URL = top.url
+		topAlbums = append(topAlbums, album)
+	}
+	checker := &fakeChecker{owned: map[string]bool{"Bought": true}}
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)
+
+	remove, removed := pruneIgnoreRules(context.Background(), list, topAlbums, checker, now)
+
+	if len(remove) != 3 || !remove[1] || !remove[2] || !remove[5] {
+		t.Errorf("Expected lines 1, 2 and 5 to be pruned, got %v", remove)
+	}
+	expected := []string{
+		"https://www.last.fm/music/A/Bought (now in library)",
+		"https://www.last.fm/music/A/Forgotten (not in all-time top albums)",
+		"https://www.last.fm/music/A/Later snooze-until=2025-01-01 (snooze expired)",
+	}
+	if strings.Join(removed, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected removals:\n%s", strings.Join(removed, "\n"))
+	}
+}
+
+func TestRemovePrunedRules(t *testing.T) {
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	content := "https://www.last.fm/music/A/Bought\nartist: A\n"
+	if err := os.WriteFile(ignoreFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	remove := map[int]bool{1: true}
+	removed := []string{"https://www.last.fm/music/A/Bought (now in library)"}
+
+	output := captureStdout(t, func() {
+		if err := removePrunedRules(ignoreFile, remove, removed, true); err != nil {
+			t.Error(err)
+		}
+	})
+	if output != "Would remove: https://www.last.fm/music/A/Bought (now in library)\n" {
+		t.Errorf("Unexpected dry run output: %q", output)
+	}
+	if data, err := os.ReadFile(ignoreFile); err != nil || string(data) != content {
+		t.Errorf("Expected a dry run to leave the ignore file alone, got %q (%v)", data, err)
+	}
+
+	captureStdout(t, func() {
+		if err := removePrunedRules(ignoreFile, remove, removed, false); err != nil {
+			t.Error(err)
+		}
+	})
+	if data, err := os.ReadFile(ignoreFile); err != nil || string(data) != "artist: A\n" {
+		t.Errorf("Expected the pruned rule to be removed, got %q (%v)", data, err)
+	}
+}
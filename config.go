@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources a setting value can be resolved from, in increasing order of precedence
+const (
+	sourceDefault = "default"
+	sourceFile    = "config file"
+	sourceEnv     = "environment"
+	sourceFlag    = "flag"
+)
+
+// configPathEnv names the environment variable that points at an alternative config file
+const configPathEnv = "ALBUM2BUY_CONFIG"
+
+// setting describes a single configuration value. Every setting can be given
+// as a command-line flag, an environment variable or a config file entry.
+type setting struct {
+	Key     string // environment variable and config file key
+	Flag    string // command-line flag name
+	Usage   string
+	Default string
+	Bool    bool
+	Secret  bool
+}
+
+// settings lists every configuration value the application understands
+var settings = []setting{
+	{Key: "LASTFM_API_KEY", Flag: "lastfm-api-key", Usage: "Last.fm API key", Secret: true},
+	{Key: "LASTFM_USER", Flag: "lastfm-user", Usage: "Last.fm username"},
+	{Key: "LASTFM_PERIOD", Flag: "period", Usage: "Last.fm time period: overall, 7day, 1month, 3month, 6month or 12month", Default: "12month"},
+	{Key: "LASTFM_MAX_ALBUMS", Flag: "max-albums", Usage: "maximum number of Last.fm top albums to check, 0 for all", Default: strconv.Itoa(lastFMAlbumLimit)},
+	{Key: "LASTFM_MAX_TRACKS", Flag: "max-tracks", Usage: "maximum number of Last.fm top tracks to check with the tracks command, 0 for all", Default: strconv.Itoa(lastFMTrackLimit)},
+	{Key: "MAX_RECOMMENDATIONS", Flag: "count", Usage: "number of albums to recommend, or \"all\" for every missing album", Default: strconv.Itoa(maxRecommendations)},
+	{Key: "OUTPUT_FORMAT", Flag: "format", Usage: "output format: text, json, csv or markdown", Default: "text"},
+	{Key: "SCORE_WEIGHT_PLAYCOUNT", Flag: "weight-playcount", Usage: "score weight of the album's play count", Default: "1"},
+	{Key: "SCORE_WEIGHT_RECENCY", Flag: "weight-recency", Usage: "score weight of recent plays of the album", Default: "0"},
+	{Key: "SCORE_WEIGHT_TRACKS", Flag: "weight-tracks", Usage: "score weight of how many of the album's tracks were played", Default: "0"},
+	{Key: "SCORE_WEIGHT_ARTIST", Flag: "weight-artist", Usage: "score weight of the artist's album count in the library, negative favours under-represented artists", Default: "0"},
+	{Key: "SUBSONIC_SERVER", Flag: "subsonic-server", Usage: "Subsonic server URL (include protocol)"},
+	{Key: "SUBSONIC_USER", Flag: "subsonic-user", Usage: "Subsonic account username"},
+	{Key: "SUBSONIC_PASSWORD", Flag: "subsonic-password", Usage: "Subsonic account password", Secret: true},
+	{Key: "SUBSONIC_WORKERS", Flag: "workers", Usage: "number of concurrent Subsonic lookups", Default: strconv.Itoa(defaultWorkers)},
+	{Key: "LIBRARY_INDEX", Flag: "library-index", Usage: "load the whole Subsonic album list up front instead of searching for each album", Default: "false", Bool: true},
+	{Key: "MATCH_THRESHOLD", Flag: "match-threshold", Usage: "similarity from 0 to 1 above which differently spelled names still match, 1 for exact matching only", Default: strconv.FormatFloat(defaultMatchThreshold, 'f', -1, 64)},
+	{Key: "EDITION_RULES_FILE", Flag: "edition-rules", Usage: "path to a list of extra edition suffixes to strip from album titles, one regular expression per line"},
+	{Key: "NO_EDITION_DEFAULTS", Flag: "no-edition-defaults", Usage: "only strip the edition suffixes of the edition rules file, not the built-in ones", Default: "false", Bool: true},
+	{Key: "ALIAS_FILE", Flag: "alias-file", Usage: "path to a list of library names of Last.fm artists"},
+	{Key: "NORMALIZE", Flag: "normalize", Usage: "comma-separated name normalization steps: fold (accents, ligatures, full-width), and (& and + as and), article (leading The of artists), or none", Default: strings.Join(normalizeSteps, ",")},
+	{Key: "PARTIAL_ALBUMS", Flag: "partial", Usage: "albums with fewer songs in the library than tracks on Last.fm: owned counts them as owned, report lists them, recommend recommends completing them", Default: partialOwned},
+	{Key: "CACHE_OWNED_TTL", Flag: "cache-owned-ttl", Usage: "how long cached lookups of owned albums stay valid, e.g. 30d or 12h (0 disables)", Default: "30d"},
+	{Key: "CACHE_MISSING_TTL", Flag: "cache-missing-ttl", Usage: "how long cached lookups of missing albums stay valid, e.g. 1d or 12h (0 disables)", Default: "1d"},
+	{Key: "NO_CACHE", Flag: "no-cache", Usage: "bypass the lookup cache", Default: "false", Bool: true},
+	{Key: "CLEAR_CACHE", Flag: "clear-cache", Usage: "delete the lookup cache before running", Default: "false", Bool: true},
+	{Key: "HISTORY_FILE", Flag: "history-file", Usage: "path of the recommendation history (default $XDG_DATA_HOME/album2buy/history.json)"},
+	{Key: "HISTORY_DIFF", Flag: "diff", Usage: "mark recommendations as NEW or STILL MISSING and list RESOLVED albums, relative to the previous run", Default: "false", Bool: true},
+	{Key: "IGNORE_FILE", Flag: "ignore-file", Usage: "path to a list of ignored Last.fm URLs"},
+	{Key: "DRY_RUN", Flag: "dry-run", Usage: "list the rules ignore prune would remove without changing the ignore file", Default: "false", Bool: true},
+	{Key: "VERBOSE", Flag: "verbose", Usage: "detailed error reporting", Default: "false", Bool: true},
+	{Key: "INSECURE_SKIP_VERIFY", Flag: "insecure-skip-verify", Usage: "skip TLS certificate verification", Default: "false", Bool: true},
+}
+
+// lookupSetting returns the setting registered under key
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// settingValue is a resolved setting value together with where it came from
+type settingValue struct {
+	Value  string
+	Source string
+}
+
+// Config holds all configuration values resolved from flags, environment variables and the config file
+type Config struct {
+	LastFMAPIKey       string
+	LastFMUser         string
+	LastFMPeriod       string
+	LastFMMaxAlbums    int
+	LastFMMaxTracks    int
+	MaxRecommendations int // 0 recommends every missing album
+	OutputFormat       string
+	ScoreWeights       ScoreWeights
+	SubsonicServer     string
+	SubsonicUser       string
+	SubsonicPass       string
+	Workers            int
+	LibraryIndex       bool
+	MatchThreshold     float64
+	EditionRulesFile   string
+	NoEditionDefaults  bool
+	AliasFile          string
+	NormalizeSteps     []string
+	PartialAlbums      string // partialOwned, partialReport or partialRecommend
+	CacheOwnedTTL      time.Duration
+	CacheMissingTTL    time.Duration
+	NoCache            bool
+	ClearCache         bool
+	HistoryFile        string
+	Diff               bool
+	IgnoreFile         string
+	DryRun             bool
+	Verbose            bool
+	InsecureSkipVerify bool
+
+	// ConfigFile is the config file that was read, empty if none was found
+	ConfigFile string
+
+	values map[string]settingValue
+}
+
+// loadConfig resolves every setting with flags taking precedence over environment
+// variables, which take precedence over the config file. flagValues holds the
+// flags given on the command line keyed by setting key, configPath an explicit
+// config file location (empty to use ALBUM2BUY_CONFIG or the default location).
+func loadConfig(flagValues map[string]string, configPath string) (*Config, error) {
+	path, explicit := configPath, configPath != ""
+	if !explicit {
+		path, explicit = os.Getenv(configPathEnv), os.Getenv(configPathEnv) != ""
+	}
+	if !explicit {
+		path = defaultConfigPath()
+	}
+
+	fileValues := map[string]string{}
+	if path != "" {
+		var err error
+		fileValues, err = readConfigFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+			path = ""
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	cfg := &Config{
+		ConfigFile: path,
+		values:     make(map[string]settingValue, len(settings)),
+	}
+
+	for _, s := range settings {
+		v := settingValue{Value: s.Default, Source: sourceDefault}
+		if value, ok := fileValues[s.Key]; ok {
+			v = settingValue{Value: value, Source: sourceFile}
+		}
+		if value := os.Getenv(s.Key); value != "" {
+			v = settingValue{Value: value, Source: sourceEnv}
+		}
+		if value, ok := flagValues[s.Key]; ok {
+			v = settingValue{Value: value, Source: sourceFlag}
+		}
+		cfg.values[s.Key] = v
+	}
+
+	var err error
+	cfg.LastFMAPIKey = cfg.Get("LASTFM_API_KEY")
+	cfg.LastFMUser = cfg.Get("LASTFM_USER")
+	cfg.LastFMPeriod = cfg.Get("LASTFM_PERIOD")
+	if _, ok := lastFMPeriods[cfg.LastFMPeriod]; !ok {
+		return nil, fmt.Errorf("invalid value %q for LASTFM_PERIOD (from %s): expected one of overall, 7day, 1month, 3month, 6month, 12month",
+			cfg.LastFMPeriod, cfg.Source("LASTFM_PERIOD"))
+	}
+	if cfg.LastFMMaxAlbums, err = cfg.intValue("LASTFM_MAX_ALBUMS"); err != nil {
+		return nil, err
+	}
+	if cfg.LastFMMaxTracks, err = cfg.intValue("LASTFM_MAX_TRACKS"); err != nil {
+		return nil, err
+	}
+	if cfg.Get("MAX_RECOMMENDATIONS") == "all" {
+		cfg.MaxRecommendations = 0
+	} else if cfg.MaxRecommendations, err = cfg.intValue("MAX_RECOMMENDATIONS"); err != nil {
+		return nil, err
+	} else if cfg.MaxRecommendations == 0 {
+		return nil, fmt.Errorf("invalid value \"0\" for MAX_RECOMMENDATIONS (from %s): use \"all\" for every missing album",
+			cfg.Source("MAX_RECOMMENDATIONS"))
+	}
+	cfg.OutputFormat = cfg.Get("OUTPUT_FORMAT")
+	if _, ok := outputFormats[cfg.OutputFormat]; !ok {
+		return nil, fmt.Errorf("invalid value %q for OUTPUT_FORMAT (from %s): expected one of %s",
+			cfg.OutputFormat, cfg.Source("OUTPUT_FORMAT"), strings.Join(outputFormatNames(), ", "))
+	}
+	for key, weight := range map[string]*float64{
+		"SCORE_WEIGHT_PLAYCOUNT": &cfg.ScoreWeights.PlayCount,
+		"SCORE_WEIGHT_RECENCY":   &cfg.ScoreWeights.Recency,
+		"SCORE_WEIGHT_TRACKS":    &cfg.ScoreWeights.Tracks,
+		"SCORE_WEIGHT_ARTIST":    &cfg.ScoreWeights.Artist,
+	} {
+		if *weight, err = cfg.floatValue(key); err != nil {
+			return nil, err
+		}
+	}
+	cfg.SubsonicServer = cfg.Get("SUBSONIC_SERVER")
+	cfg.SubsonicUser = cfg.Get("SUBSONIC_USER")
+	cfg.SubsonicPass = cfg.Get("SUBSONIC_PASSWORD")
+	if cfg.Workers, err = cfg.intValue("SUBSONIC_WORKERS"); err != nil {
+		return nil, err
+	} else if cfg.Workers == 0 {
+		return nil, fmt.Errorf("invalid value \"0\" for SUBSONIC_WORKERS (from %s): at least one worker is needed",
+			cfg.Source("SUBSONIC_WORKERS"))
+	}
+	if cfg.LibraryIndex, err = cfg.boolValue("LIBRARY_INDEX"); err != nil {
+		return nil, err
+	}
+	if cfg.MatchThreshold, err = cfg.floatValue("MATCH_THRESHOLD"); err != nil {
+		return nil, err
+	} else if cfg.MatchThreshold <= 0 || cfg.MatchThreshold > 1 {
+		return nil, fmt.Errorf("invalid value %q for MATCH_THRESHOLD (from %s): expected a number above 0 and at most 1",
+			cfg.Get("MATCH_THRESHOLD"), cfg.Source("MATCH_THRESHOLD"))
+	}
+	cfg.EditionRulesFile = cfg.Get("EDITION_RULES_FILE")
+	if cfg.NoEditionDefaults, err = cfg.boolValue("NO_EDITION_DEFAULTS"); err != nil {
+		return nil, err
+	}
+	cfg.AliasFile = cfg.Get("ALIAS_FILE")
+	if cfg.NormalizeSteps, err = cfg.normalizeStepsValue("NORMALIZE"); err != nil {
+		return nil, err
+	}
+	cfg.PartialAlbums = cfg.Get("PARTIAL_ALBUMS")
+	if !slices.Contains(partialModes, cfg.PartialAlbums) {
+		return nil, fmt.Errorf("invalid value %q for PARTIAL_ALBUMS (from %s): expected one of %s",
+			cfg.PartialAlbums, cfg.Source("PARTIAL_ALBUMS"), strings.Join(partialModes, ", "))
+	}
+	if cfg.CacheOwnedTTL, err = cfg.durationValue("CACHE_OWNED_TTL"); err != nil {
+		return nil, err
+	}
+	if cfg.CacheMissingTTL, err = cfg.durationValue("CACHE_MISSING_TTL"); err != nil {
+		return nil, err
+	}
+	if cfg.NoCache, err = cfg.boolValue("NO_CACHE"); err != nil {
+		return nil, err
+	}
+	if cfg.ClearCache, err = cfg.boolValue("CLEAR_CACHE"); err != nil {
+		return nil, err
+	}
+	cfg.HistoryFile = cfg.Get("HISTORY_FILE")
+	if cfg.Diff, err = cfg.boolValue("HISTORY_DIFF"); err != nil {
+		return nil, err
+	}
+	cfg.IgnoreFile = cfg.Get("IGNORE_FILE")
+	if cfg.DryRun, err = cfg.boolValue("DRY_RUN"); err != nil {
+		return nil, err
+	}
+	if cfg.Verbose, err = cfg.boolValue("VERBOSE"); err != nil {
+		return nil, err
+	}
+	if cfg.InsecureSkipVerify, err = cfg.boolValue("INSECURE_SKIP_VERIFY"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Get returns the resolved raw value of a setting
+func (c *Config) Get(key string) string {
+	return c.values[key].Value
+}
+
+// Source reports where the value of a setting came from
+func (c *Config) Source(key string) string {
+	return c.values[key].Source
+}
+
+// boolValue parses a boolean setting. Environment variables other than true or false
+// only warn and count as false, as they always did before flags and the config file.
+func (c *Config) boolValue(key string) (bool, error) {
+	v := c.values[key]
+	if v.Value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v.Value)
+	if err != nil && v.Source == sourceEnv {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring invalid value %q for %s (from %s): expected true or false\n", v.Value, key, v.Source)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s (from %s): expected true or false", v.Value, key, v.Source)
+	}
+	return b, nil
+}
+
+// intValue parses a non-negative integer setting
+func (c *Config) intValue(key string) (int, error) {
+	v := c.values[key]
+	if v.Value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v.Value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s (from %s): expected a non-negative number", v.Value, key, v.Source)
+	}
+	return n, nil
+}
+
+// floatValue parses a decimal setting
+func (c *Config) floatValue(key string) (float64, error) {
+	v := c.values[key]
+	if v.Value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s (from %s): expected a number", v.Value, key, v.Source)
+	}
+	return f, nil
+}
+
+// normalizeStepsValue parses a comma-separated list of normalization steps, where "none" disables them all
+func (c *Config) normalizeStepsValue(key string) ([]string, error) {
+	v := c.values[key]
+	if v.Value == "" || v.Value == "none" {
+		return nil, nil
+	}
+
+	var steps []string
+	for _, step := range strings.Split(v.Value, ",") {
+		step = strings.TrimSpace(step)
+		if !slices.Contains(normalizeSteps, step) {
+			return nil, fmt.Errorf("invalid value %q for %s (from %s): expected none or a comma-separated list of %s",
+				v.Value, key, v.Source, strings.Join(normalizeSteps, ", "))
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// durationValue parses a non-negative duration setting, accepting whole days
+// such as "30d" besides Go durations such as "12h"
+func (c *Config) durationValue(key string) (time.Duration, error) {
+	v := c.values[key]
+	if v.Value == "" {
+		return 0, nil
+	}
+
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(v.Value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v.Value)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s (from %s): expected a duration such as 30d or 12h", v.Value, key, v.Source)
+	}
+	return d, nil
+}
+
+// require returns an error naming every given setting that has no value
+func (c *Config) require(keys ...string) error {
+	missing := []string{}
+	for _, key := range keys {
+		if c.Get(key) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// requireLastFM checks that the Last.fm credentials are configured
+func (c *Config) requireLastFM() error {
+	return c.require("LASTFM_API_KEY", "LASTFM_USER")
+}
+
+// requireSubsonic checks that the Subsonic server and credentials are configured
+func (c *Config) requireSubsonic() error {
+	return c.require("SUBSONIC_SERVER", "SUBSONIC_USER", "SUBSONIC_PASSWORD")
+}
+
+// defaultConfigPath returns the config file location inside the user's config directory
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "album2buy", "config")
+}
+
+// readConfigFile parses a config file of KEY=VALUE lines using the same keys
+// as the environment variables. Blank lines and lines starting with # are skipped.
+func readConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		if _, known := lookupSetting(key); !known {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q", path, lineNo, key)
+		}
+		values[key] = unquote(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return values, nil
+}
+
+// unquote strips a single pair of matching surrounding quotes
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
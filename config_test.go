@@ -0,0 +1,383 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateConfig clears every setting from the environment and points the
+// default config location at an empty temporary directory
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(configPathEnv, "")
+	for _, s := range settings {
+		t.Setenv(s.Key, "")
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	isolateConfig(t)
+	path := writeConfigFile(t, "# comment\nLASTFM_USER=file-user\nSUBSONIC_SERVER=\"https://file.example.com\"\nSUBSONIC_USER=file-subsonic\n")
+
+	t.Setenv("SUBSONIC_SERVER", "https://env.example.com")
+	t.Setenv("SUBSONIC_USER", "env-subsonic")
+
+	cfg, err := loadConfig(map[string]string{"SUBSONIC_USER": "flag-subsonic"}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		source string
+	}{
+		{"LASTFM_USER", "file-user", sourceFile},
+		{"SUBSONIC_SERVER", "https://env.example.com", sourceEnv},
+		{"SUBSONIC_USER", "flag-subsonic", sourceFlag},
+		{"VERBOSE", "false", sourceDefault},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.Get(tt.key); got != tt.value {
+			t.Errorf("Expected %s=%q, got %q", tt.key, tt.value, got)
+		}
+		if got := cfg.Source(tt.key); got != tt.source {
+			t.Errorf("Expected %s from %s, got %s", tt.key, tt.source, got)
+		}
+	}
+
+	if cfg.LastFMUser != "file-user" || cfg.SubsonicUser != "flag-subsonic" {
+		t.Errorf("Config fields not populated from resolved values: %+v", cfg)
+	}
+
+	if cfg.ConfigFile != path {
+		t.Errorf("Expected ConfigFile %s, got %s", path, cfg.ConfigFile)
+	}
+}
+
+func TestLoadConfigBoolSettings(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv("VERBOSE", "true")
+
+	cfg, err := loadConfig(map[string]string{"INSECURE_SKIP_VERIFY": "true"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.Verbose {
+		t.Error("Expected Verbose to be true")
+	}
+	if !cfg.InsecureSkipVerify {
+		t.Error("Expected InsecureSkipVerify to be true")
+	}
+
+	t.Setenv("VERBOSE", "sometimes")
+	cfg, err = loadConfig(nil, "")
+	if err != nil {
+		t.Fatalf("Expected an invalid VERBOSE variable to be ignored, got: %v", err)
+	}
+	if cfg.Verbose {
+		t.Error("Expected an invalid VERBOSE variable to count as false")
+	}
+
+	t.Setenv("VERBOSE", "")
+	path := writeConfigFile(t, "VERBOSE=sometimes\n")
+	if _, err := loadConfig(nil, path); err == nil || !strings.Contains(err.Error(), "VERBOSE") {
+		t.Errorf("Expected error about invalid VERBOSE value, got: %v", err)
+	}
+}
+
+func TestLoadConfigPeriod(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LastFMPeriod != "12month" {
+		t.Errorf("Expected default period 12month, got %s", cfg.LastFMPeriod)
+	}
+
+	cfg, err = loadConfig(map[string]string{"LASTFM_PERIOD": "overall"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LastFMPeriod != "overall" {
+		t.Errorf("Expected period overall, got %s", cfg.LastFMPeriod)
+	}
+
+	if _, err := loadConfig(map[string]string{"LASTFM_PERIOD": "2week"}, ""); err == nil {
+		t.Error("Expected error for unsupported period")
+	}
+}
+
+func TestLoadConfigMaxAlbums(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LastFMMaxAlbums != lastFMAlbumLimit {
+		t.Errorf("Expected default max albums %d, got %d", lastFMAlbumLimit, cfg.LastFMMaxAlbums)
+	}
+
+	t.Setenv("LASTFM_MAX_ALBUMS", "0")
+	cfg, err = loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LastFMMaxAlbums != 0 {
+		t.Errorf("Expected max albums 0, got %d", cfg.LastFMMaxAlbums)
+	}
+
+	for _, value := range []string{"-1", "lots"} {
+		if _, err := loadConfig(map[string]string{"LASTFM_MAX_ALBUMS": value}, ""); err == nil {
+			t.Errorf("Expected error for LASTFM_MAX_ALBUMS=%s", value)
+		}
+	}
+}
+
+func TestLoadConfigMaxRecommendations(t *testing.T) {
+	isolateConfig(t)
+
+	tests := []struct {
+		value    string
+		expected int
+		wantErr  bool
+	}{
+		{"", maxRecommendations, false},
+		{"20", 20, false},
+		{"all", 0, false},
+		{"0", 0, true},
+		{"some", 0, true},
+	}
+
+	for _, tt := range tests {
+		flags := map[string]string{}
+		if tt.value != "" {
+			flags["MAX_RECOMMENDATIONS"] = tt.value
+		}
+
+		cfg, err := loadConfig(flags, "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for MAX_RECOMMENDATIONS=%q", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.MaxRecommendations != tt.expected {
+			t.Errorf("MAX_RECOMMENDATIONS=%q: expected %d, got %d", tt.value, tt.expected, cfg.MaxRecommendations)
+		}
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	isolateConfig(t)
+	path := writeConfigFile(t, "LASTFM_USER=env-file-user\n")
+	t.Setenv(configPathEnv, path)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.LastFMUser != "env-file-user" {
+		t.Errorf("Expected LastFMUser from %s file, got %q", configPathEnv, cfg.LastFMUser)
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatalf("Missing default config file should not be an error: %v", err)
+	}
+	if cfg.ConfigFile != "" {
+		t.Errorf("Expected no config file, got %s", cfg.ConfigFile)
+	}
+
+	if _, err := loadConfig(nil, filepath.Join(t.TempDir(), "nope")); err == nil {
+		t.Error("Expected error for explicitly given config file that does not exist")
+	}
+}
+
+func TestReadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errPart string
+	}{
+		{"unknown key", "NOT_A_SETTING=1\n", "unknown setting"},
+		{"missing separator", "\nLASTFM_USER\n", ":2: expected KEY=VALUE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readConfigFile(writeConfigFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errPart, err)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileExportAndQuotes(t *testing.T) {
+	values, err := readConfigFile(writeConfigFile(t, "export LASTFM_USER='quoted user'\n  SUBSONIC_USER = spaced  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["LASTFM_USER"] != "quoted user" {
+		t.Errorf("Expected quoted value to be unquoted, got %q", values["LASTFM_USER"])
+	}
+	if values["SUBSONIC_USER"] != "spaced" {
+		t.Errorf("Expected value to be trimmed, got %q", values["SUBSONIC_USER"])
+	}
+}
+
+func TestLoadConfigWorkers(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != defaultWorkers {
+		t.Errorf("Expected default workers %d, got %d", defaultWorkers, cfg.Workers)
+	}
+
+	cfg, err = loadConfig(map[string]string{"SUBSONIC_WORKERS": "16"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != 16 {
+		t.Errorf("Expected 16 workers, got %d", cfg.Workers)
+	}
+
+	for _, value := range []string{"0", "-2", "many"} {
+		if _, err := loadConfig(map[string]string{"SUBSONIC_WORKERS": value}, ""); err == nil {
+			t.Errorf("Expected error for SUBSONIC_WORKERS=%s", value)
+		}
+	}
+}
+
+func TestLoadConfigCacheTTL(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CacheOwnedTTL != 30*24*time.Hour || cfg.CacheMissingTTL != 24*time.Hour {
+		t.Errorf("Unexpected default TTLs %v and %v", cfg.CacheOwnedTTL, cfg.CacheMissingTTL)
+	}
+
+	cfg, err = loadConfig(map[string]string{"CACHE_OWNED_TTL": "90m", "CACHE_MISSING_TTL": "0"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CacheOwnedTTL != 90*time.Minute || cfg.CacheMissingTTL != 0 {
+		t.Errorf("Unexpected TTLs %v and %v", cfg.CacheOwnedTTL, cfg.CacheMissingTTL)
+	}
+
+	for _, value := range []string{"-1h", "soon", "xd"} {
+		if _, err := loadConfig(map[string]string{"CACHE_OWNED_TTL": value}, ""); err == nil {
+			t.Errorf("Expected error for CACHE_OWNED_TTL=%s", value)
+		}
+	}
+}
+
+func TestLoadConfigMatchThreshold(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MatchThreshold != defaultMatchThreshold {
+		t.Errorf("Expected default threshold %v, got %v", defaultMatchThreshold, cfg.MatchThreshold)
+	}
+
+	cfg, err = loadConfig(map[string]string{"MATCH_THRESHOLD": "1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MatchThreshold != 1 {
+		t.Errorf("Expected threshold 1, got %v", cfg.MatchThreshold)
+	}
+
+	for _, value := range []string{"0", "-0.5", "1.5", "close"} {
+		if _, err := loadConfig(map[string]string{"MATCH_THRESHOLD": value}, ""); err == nil {
+			t.Errorf("Expected error for MATCH_THRESHOLD=%s", value)
+		}
+	}
+}
+
+func TestLoadConfigNormalize(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.NormalizeSteps, normalizeSteps) {
+		t.Errorf("Expected every step by default, got %v", cfg.NormalizeSteps)
+	}
+
+	for value, expected := range map[string][]string{
+		"none":          nil,
+		"fold":          {stepFold},
+		" article,and ": {stepArticle, stepAnd},
+	} {
+		cfg, err := loadConfig(map[string]string{"NORMALIZE": value}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(cfg.NormalizeSteps, expected) {
+			t.Errorf("NORMALIZE=%q: expected %v, got %v", value, expected, cfg.NormalizeSteps)
+		}
+	}
+
+	if _, err := loadConfig(map[string]string{"NORMALIZE": "fold,nfc"}, ""); err == nil {
+		t.Error("Expected error for an unknown normalization step")
+	}
+}
+
+func TestLoadConfigPartialAlbums(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PartialAlbums != partialOwned {
+		t.Errorf("Expected partial albums to count as owned by default, got %q", cfg.PartialAlbums)
+	}
+
+	if cfg, err := loadConfig(map[string]string{"PARTIAL_ALBUMS": "recommend"}, ""); err != nil || cfg.PartialAlbums != partialRecommend {
+		t.Errorf("Expected recommend, got %v (%v)", cfg, err)
+	}
+	if _, err := loadConfig(map[string]string{"PARTIAL_ALBUMS": "complete"}, ""); err == nil {
+		t.Error("Expected error for an unknown PARTIAL_ALBUMS value")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// candidateVerdict tells whether a library album is taken to be the Last.fm album, and why
+type candidateVerdict struct {
+	Candidate   matchCandidate
+	Artist      string  // normalized library artist
+	Title       string  // normalized library title
+	ArtistScore float64 // similarity to the closest of the artist's names
+	TitleScore  float64
+	Match       bool
+	Reason      string
+}
+
+// Explain compares the album with every candidate by the same rules as Match, in the same
+// order, and reports for each candidate the rule that decided it
+func (m *Matcher) Explain(album Album, candidates []matchCandidate) []candidateVerdict {
+	n := m.normalizer()
+	artists, title := m.artistNames(album.Artist.Name), n.Title(album.Name)
+	threshold := m.threshold()
+
+	verdicts := make([]candidateVerdict, len(candidates))
+	for i, c := range candidates {
+		v := candidateVerdict{Candidate: c, Artist: n.Artist(c.Artist), Title: n.Title(c.Title)}
+		v.ArtistScore = artistSimilarity(artists, v.Artist)
+		v.TitleScore = similarity(title, v.Title)
+		artist := slices.Index(artists, v.Artist)
+		numbers, cNumbers := numberTokens(strings.Fields(title)), numberTokens(strings.Fields(v.Title))
+
+		switch {
+		case album.MBID != "" && strings.EqualFold(c.MBID, album.MBID):
+			v.Match, v.Reason = true, "same MusicBrainz ID"
+		case artist == 0 && v.Title == title:
+			v.Match, v.Reason = true, "same name"
+		case artist > 0 && v.Title == title:
+			v.Match, v.Reason = true, "same title, artist by alias"
+		case threshold == 1 && artist < 0:
+			v.Reason = "artist differs and the threshold of 1 requires equal names"
+		case threshold == 1:
+			v.Reason = "title differs and the threshold of 1 requires equal names"
+		case !slices.Equal(numbers, cNumbers):
+			v.Reason = fmt.Sprintf("title numbers differ (%s vs %s)", numbersText(numbers), numbersText(cNumbers))
+		case min(v.ArtistScore, v.TitleScore) >= threshold:
+			v.Match, v.Reason = true, fmt.Sprintf("similar names (score %.2f, threshold %.2f)", min(v.ArtistScore, v.TitleScore), threshold)
+		default:
+			v.Reason = fmt.Sprintf("below threshold (score %.2f, threshold %.2f)", min(v.ArtistScore, v.TitleScore), threshold)
+		}
+		if !v.Match && album.MBID != "" && c.MBID != "" {
+			v.Reason += ", MusicBrainz IDs differ"
+		}
+		verdicts[i] = v
+	}
+	return verdicts
+}
+
+// numbersText lists number tokens for an explanation
+func numbersText(numbers []string) string {
+	if len(numbers) == 0 {
+		return "none"
+	}
+	return strings.Join(numbers, " ")
+}
+
+// printExplanation writes how the album was looked up and how every album found compares to it
+func printExplanation(out io.Writer, album Album, m *Matcher, searches []librarySearch) {
+	n := m.normalizer()
+	artists := m.artistNames(album.Artist.Name)
+
+	fmt.Fprintf(out, "Last.fm:    %s - %s\n", album.Artist.Name, album.Name)
+	fmt.Fprintf(out, "  cleaned:  %s - %s\n", cleanString(album.Artist.Name), cleanString(album.Name))
+	fmt.Fprintf(out, "  compared: %s - %s\n", artists[0], n.Title(album.Name))
+	if len(artists) > 1 {
+		fmt.Fprintf(out, "  aliases:  %s\n", strings.Join(artists[1:], ", "))
+	}
+	if album.MBID != "" {
+		fmt.Fprintf(out, "  MBID:     %s\n", album.MBID)
+	}
+	fmt.Fprintf(out, "Threshold:  %.2f\n", m.threshold())
+
+	// Explain lists every candidate that clears the threshold; the one reported as the match
+	// is the one Match picks, without logging it a second time
+	var quiet Matcher
+	if m != nil {
+		quiet = *m
+	}
+	quiet.Log = nil
+
+	var verdicts []candidateVerdict
+	var match *candidateVerdict
+	var alternatives []string
+	for _, search := range searches {
+		found := fmt.Sprintf("%d library albums", len(search.Albums))
+		if len(search.Albums) == 1 {
+			found = "1 library album"
+		}
+		fmt.Fprintf(out, "\n%s %q found %s", search.Method, search.Query, found)
+		if search.Method == "search3" && len(search.Albums) >= searchAlbumLimit {
+			fmt.Fprint(out, ", as many as a search returns")
+		}
+		fmt.Fprintln(out)
+
+		candidates := searchCandidates(search.Albums)
+		chosen := -1
+		if match == nil {
+			chosen, _ = quiet.choose(album, candidates)
+		}
+		for i, v := range m.Explain(album, candidates) {
+			verdicts = append(verdicts, v)
+			fmt.Fprintf(out, "\n%d. %s\n", len(verdicts), v.Candidate)
+			fmt.Fprintf(out, "   cleaned:  %s - %s\n", cleanString(v.Candidate.Artist), cleanString(v.Candidate.Title))
+			fmt.Fprintf(out, "   compared: %s - %s\n", v.Artist, v.Title)
+			if v.Candidate.MBID != "" {
+				fmt.Fprintf(out, "   MBID:     %s\n", v.Candidate.MBID)
+			}
+			fmt.Fprintf(out, "   scores:   artist %.2f, title %.2f\n", v.ArtistScore, v.TitleScore)
+			switch {
+			case i == chosen:
+				fmt.Fprintf(out, "   MATCH:    %s\n", v.Reason)
+				match = &v
+			case v.Match:
+				fmt.Fprintf(out, "   also:     %s\n", v.Reason)
+				alternatives = append(alternatives, fmt.Sprintf("%d. %s", len(verdicts), v.Candidate))
+			default:
+				fmt.Fprintf(out, "   rejected: %s\n", v.Reason)
+			}
+		}
+	}
+
+	if match != nil {
+		fmt.Fprintf(out, "\nResult: in library as %s\n", match.Candidate)
+		if len(alternatives) > 0 {
+			fmt.Fprintf(out, "Alternatives: %s\n", strings.Join(alternatives, ", "))
+		}
+		return
+	}
+	fmt.Fprintln(out, "\nResult: missing")
+	if hint := explanationHint(album, m, verdicts); hint != "" {
+		fmt.Fprintf(out, "Hint: %s\n", hint)
+	}
+}
+
+// explanationHint suggests a fix for the most common reasons a library album is not matched:
+// an artist under another name, or a title with an unknown suffix
+func explanationHint(album Album, m *Matcher, verdicts []candidateVerdict) string {
+	title := m.normalizer().Title(album.Name)
+	for _, v := range verdicts {
+		if v.Title == title {
+			alias := ArtistAlias{Artist: album.Artist.Name, Library: []string{v.Candidate.Artist}}
+			return fmt.Sprintf("if %q is the same artist, add \"%s\" to the alias file", v.Candidate.Artist, alias)
+		}
+	}
+	for _, v := range verdicts {
+		if v.ArtistScore == 1 && (strings.HasPrefix(v.Title, title+" ") || strings.HasPrefix(title, v.Title+" ")) {
+			return fmt.Sprintf("if %q is the same album, add an edition rule for the suffix that sets the titles apart", v.Candidate.Title)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatcherExplain(t *testing.T) {
+	normalizer, err := NewNormalizer(true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalizer.EnableSteps(normalizeSteps)
+	matcher := &Matcher{
+		Threshold:  0.9,
+		Normalizer: normalizer,
+		Aliases:    []ArtistAlias{{Artist: "Dream Theater", Library: []string{"DT"}}},
+	}
+
+	album := testAlbum("Dream Theater", "Images and Words Vol. 2")
+	album.MBID = "b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"
+
+	tests := []struct {
+		candidate matchCandidate
+		match     bool
+		reason    string
+	}{
+		{matchCandidate{Artist: "ドリーム・シアター", Title: "イメージズ", MBID: strings.ToUpper(album.MBID)}, true, "same MusicBrainz ID"},
+		{matchCandidate{Artist: "Dream Theater", Title: "Images & Words Vol. 2 (Remastered)"}, true, "same name"},
+		{matchCandidate{Artist: "DT", Title: "Images and Words Vol 2"}, true, "same title, artist by alias"},
+		{matchCandidate{Artist: "Dream Theatre", Title: "Images and Words Vol. 2"}, true, "similar names"},
+		{matchCandidate{Artist: "Dream Theater", Title: "Images and Words Vol. 3"}, false, "title numbers differ (2 vs 3)"},
+		{matchCandidate{Artist: "Dream Theater", Title: "Awake Vol. 2", MBID: "0a9c7a6e-0000-4000-8000-000000000000"}, false, "below threshold"},
+	}
+
+	var candidates []matchCandidate
+	for _, tt := range tests {
+		candidates = append(candidates, tt.candidate)
+	}
+	verdicts := matcher.Explain(album, candidates)
+
+	for i, tt := range tests {
+		v := verdicts[i]
+		if v.Match != tt.match || !strings.HasPrefix(v.Reason, tt.reason) {
+			t.Errorf("%s: expected match %v because %q, got %v because %q", tt.candidate, tt.match, tt.reason, v.Match, v.Reason)
+		}
+		if got := matcher.Match(album, []matchCandidate{tt.candidate}).Owned; got != v.Match {
+			t.Errorf("%s: Explain says match %v but Match says %v", tt.candidate, v.Match, got)
+		}
+	}
+	if !strings.HasSuffix(verdicts[5].Reason, ", MusicBrainz IDs differ") {
+		t.Errorf("Expected differing MusicBrainz IDs to be pointed out, got %q", verdicts[5].Reason)
+	}
+
+	exact := &Matcher{Threshold: 1, Normalizer: normalizer}
+	verdicts = exact.Explain(album, candidates[3:5])
+	if verdicts[0].Match || !strings.HasPrefix(verdicts[0].Reason, "artist differs") || !strings.HasPrefix(verdicts[1].Reason, "title differs") {
+		t.Errorf("Expected equal names to be required, got %+v", verdicts)
+	}
+}
+
+func TestPrintExplanationHints(t *testing.T) {
+	matcher := &Matcher{Threshold: 1, Normalizer: &Normalizer{}}
+	album := testAlbum("坂本龍一", "Async")
+
+	var out bytes.Buffer
+	searches := []librarySearch{{Method: "search3", Query: "Async", Albums: []SubsonicAlbum{{Artist: "Ryuichi Sakamoto", Title: "async"}}}}
+	printExplanation(&out, album, matcher, searches)
+	for _, want := range []string{
+		`search3 "Async" found 1 library album`,
+		"rejected: artist differs",
+		"Result: missing",
+		`add "坂本龍一 = Ryuichi Sakamoto" to the alias file`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected explanation to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	searches[0].Albums = []SubsonicAlbum{{Artist: "坂本龍一", Title: "Async Remodels"}}
+	printExplanation(&out, album, matcher, searches)
+	if !strings.Contains(out.String(), "add an edition rule") {
+		t.Errorf("Expected an edition rule hint, got:\n%s", out.String())
+	}
+}
+
+func TestRunExplain(t *testing.T) {
+	isolateConfig(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query().Get("query"); query != "Parasomnia" {
+			t.Errorf("Expected the edition suffix to be left out of the search, got %q", query)
+		}
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{"album":[
+			{"name":"Parasomnia","artist":"Dream Theater"},
+			{"name":"Parasomnia (Live)","artist":"Parasomnia Tribute Band"}]}}}`))
+	}))
+	defer server.Close()
+
+	output := captureStdout(t, func() {
+		code := run([]string{"explain", "--subsonic-server", server.URL, "--subsonic-user", "u", "--subsonic-password", "p",
+			"--match-threshold", "0.9", "Dream Theater", "Parasomnia (24-bit HD audio)"})
+		if code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+	for _, want := range []string{
+		"cleaned:  Dream Theater - Parasomnia",
+		"compared: dream theater - parasomnia",
+		`search3 "Parasomnia" found 2 library albums`,
+		"MATCH:    same name",
+		"rejected: below threshold",
+		"Result: in library as Dream Theater - Parasomnia",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected explanation to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestPrintExplanationReportsBestMatch(t *testing.T) {
+	var log bytes.Buffer
+	matcher := &Matcher{Threshold: 0.9, Log: &log}
+	album := testAlbum("Dream Theater", "Parasomnia")
+
+	var out bytes.Buffer
+	searches := []librarySearch{{Method: "search3", Query: "Parasomnia", Albums: []SubsonicAlbum{
+		{Artist: "Dream Theatre", Title: "Parasomnai"},
+		{Artist: "Dream Theater", Title: "Parasomnia"},
+	}}}
+	printExplanation(&out, album, matcher, searches)
+	for _, want := range []string{
+		"also:     similar names",
+		"MATCH:    same name",
+		"Result: in library as Dream Theater - Parasomnia",
+		"Alternatives: 1. Dream Theatre - Parasomnai",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected explanation to contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if log.Len() != 0 {
+		t.Errorf("Expected the explanation not to log the match, got %q", log.String())
+	}
+}
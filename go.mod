@@ -1,3 +1,10 @@
 module github.com/syeo66/album2buy
 
 go 1.23
+
+require (
+	golang.org/x/term v0.27.0
+	golang.org/x/text v0.21.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect
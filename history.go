@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// historyVersion is bumped whenever the history file layout changes incompatibly
+	historyVersion = 1
+	// historyMaxRuns caps the number of runs kept in the history file
+	historyMaxRuns = 200
+	// historyMaxDecisions caps the number of triage decisions kept in the history file
+	historyMaxDecisions = 1000
+)
+
+// Statuses of a recommendation relative to the previous run
+const (
+	statusNew          = "NEW"
+	statusStillMissing = "STILL MISSING"
+	statusResolved     = "RESOLVED"
+)
+
+// HistoryRun is a recorded recommendation run
+type HistoryRun struct {
+	Time            time.Time        `json:"time"`
+	User            string           `json:"user"`
+	Period          string           `json:"period"`
+	Recommendations []Recommendation `json:"recommendations"`
+}
+
+// Triage decisions
+const (
+	decisionBuyLater = "buy-later"
+	decisionIgnore   = "ignore"
+	decisionSnooze   = "snooze"
+	decisionSkip     = "skip"
+)
+
+// TriageDecision is a decision taken about a recommended album in interactive triage
+type TriageDecision struct {
+	Time     time.Time `json:"time"`
+	Artist   string    `json:"artist"`
+	Album    string    `json:"album"`
+	URL      string    `json:"url"`
+	Decision string    `json:"decision"`
+}
+
+// History is the local record of past recommendation runs and triage decisions, oldest first
+type History struct {
+	Version   int              `json:"version"`
+	Runs      []HistoryRun     `json:"runs"`
+	Decisions []TriageDecision `json:"decisions,omitempty"`
+
+	path string
+}
+
+// defaultHistoryPath returns the history location inside the user's data directory
+// ($XDG_DATA_HOME/album2buy, or ~/.local/share/album2buy)
+func defaultHistoryPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "album2buy", "history.json"), nil
+}
+
+// historyPath returns the configured history file, or the default location
+func historyPath(cfg *Config) (string, error) {
+	if cfg.HistoryFile != "" {
+		return cfg.HistoryFile, nil
+	}
+	return defaultHistoryPath()
+}
+
+// LoadHistory reads the history file at path; a missing file yields an empty history
+func LoadHistory(path string) (*History, error) {
+	history := &History{Version: historyVersion, path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+
+	if err := json.Unmarshal(data, history); err != nil {
+		return nil, fmt.Errorf("parsing history %s: %w", path, err)
+	}
+	if history.Version != historyVersion {
+		return nil, fmt.Errorf("history %s has unsupported version %d", path, history.Version)
+	}
+	return history, nil
+}
+
+// runs returns the recorded runs for the given user and period, oldest first
+func (h *History) runs(user, period string) []HistoryRun {
+	var runs []HistoryRun
+	for _, run := range h.Runs {
+		if run.User == user && run.Period == period {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// Previous returns the latest recorded run for the given user and period, or nil if there is none
+func (h *History) Previous(user, period string) *HistoryRun {
+	runs := h.runs(user, period)
+	if len(runs) == 0 {
+		return nil
+	}
+	return &runs[len(runs)-1]
+}
+
+// Record appends a run, dropping the oldest runs beyond historyMaxRuns.
+// Diff annotations of the recommendations are not stored.
+func (h *History) Record(report *Report) {
+	run := HistoryRun{
+		Time:            report.GeneratedAt,
+		User:            report.User,
+		Period:          report.Period,
+		Recommendations: make([]Recommendation, len(report.Recommendations)),
+	}
+	for i, rec := range report.Recommendations {
+		rec.Status = ""
+		rec.FirstSeen = nil
+		run.Recommendations[i] = rec
+	}
+
+	h.Runs = append(h.Runs, run)
+	if len(h.Runs) > historyMaxRuns {
+		h.Runs = h.Runs[len(h.Runs)-historyMaxRuns:]
+	}
+}
+
+// Decide records a triage decision, dropping the oldest decisions beyond historyMaxDecisions
+func (h *History) Decide(decision TriageDecision) {
+	h.Decisions = append(h.Decisions, decision)
+	if len(h.Decisions) > historyMaxDecisions {
+		h.Decisions = h.Decisions[len(h.Decisions)-historyMaxDecisions:]
+	}
+}
+
+// LastDecision returns the latest triage decision about the album, or nil if there is none
+func (h *History) LastDecision(artist, album string) *TriageDecision {
+	key := albumKey(artist, album)
+	for i := len(h.Decisions) - 1; i >= 0; i-- {
+		if albumKey(h.Decisions[i].Artist, h.Decisions[i].Album) == key {
+			return &h.Decisions[i]
+		}
+	}
+	return nil
+}
+
+// Save writes the history back to disk atomically
+func (h *History) Save() error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(h.path, data, 0o600); err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	return nil
+}
+
+// recommendationKey identifies a recommended album across runs
+func recommendationKey(rec Recommendation) string {
+	return albumKey(rec.Artist, rec.Album)
+}
+
+// diffReport marks each recommendation of report as NEW or STILL MISSING relative to
+// the previous run in history. Albums recommended last time but not this time are
+// looked up again and listed as RESOLVED when they are now in the library; albums that
+// merely dropped out of the list are left out.
+func diffReport(ctx context.Context, report *Report, history *History, checker AlbumChecker) error {
+	runs := history.runs(report.User, report.Period)
+
+	current := make(map[string]bool, len(report.Recommendations))
+	for i := range report.Recommendations {
+		rec := &report.Recommendations[i]
+		key := recommendationKey(*rec)
+		current[key] = true
+
+		// Walk back through the runs that recommended the album without interruption
+		var firstSeen *time.Time
+		for j := len(runs) - 1; j >= 0 && runRecommends(runs[j], key); j-- {
+			firstSeen = &runs[j].Time
+		}
+
+		if firstSeen == nil {
+			rec.Status = statusNew
+		} else {
+			rec.Status = statusStillMissing
+			rec.FirstSeen = firstSeen
+		}
+	}
+
+	if len(runs) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, rec := range runs[len(runs)-1].Recommendations {
+		if current[recommendationKey(rec)] {
+			continue
+		}
+
+		// The MusicBrainz ID lets the library match the album even under another name
+		album := Album{Name: rec.Album, URL: rec.URL, MBID: rec.MBID}
+		album.Artist.Name = rec.Artist
+		if rec.Image != "" {
+			album.Image = []AlbumImage{{URL: rec.Image}}
+		}
+		owned, err := checker.HasAlbum(ctx, album)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("checking %s - %s: %w", rec.Artist, rec.Album, err))
+			continue
+		}
+		if owned {
+			rec.Status = statusResolved
+			report.Resolved = append(report.Resolved, rec)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runRecommends reports whether run recommended the album with the given key
+func runRecommends(run HistoryRun, key string) bool {
+	for _, rec := range run.Recommendations {
+		if recommendationKey(rec) == key {
+			return true
+		}
+	}
+	return false
+}
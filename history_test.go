@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func historyTestReport(at time.Time, albums ...string) *Report {
+	report := &Report{GeneratedAt: at, User: "testuser", Period: "12month", Recommendations: []Recommendation{}}
+	for i, album := range albums {
+		report.Recommendations = append(report.Recommendations, Recommendation{
+			Rank:   i + 1,
+			Artist: "Artist",
+			Album:  album,
+			URL:    "https://www.last.fm/music/Artist/" + album,
+		})
+	}
+	return report
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "album2buy", "history.json")
+
+	history, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Previous("testuser", "12month") != nil {
+		t.Error("Expected no previous run in an empty history")
+	}
+
+	report := historyTestReport(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), "A", "B")
+	report.Recommendations[0].Status = statusNew
+	history.Record(report)
+	if err := history.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := history.Previous("testuser", "12month")
+	if previous == nil || len(previous.Recommendations) != 2 {
+		t.Fatalf("Expected the recorded run, got %+v", previous)
+	}
+	if previous.Recommendations[0].Status != "" {
+		t.Errorf("Expected diff status not to be stored, got %q", previous.Recommendations[0].Status)
+	}
+	if history.Previous("testuser", "7day") != nil || history.Previous("someone", "12month") != nil {
+		t.Error("Expected runs of other periods and users to be kept apart")
+	}
+}
+
+func TestHistoryKeepsLatestRuns(t *testing.T) {
+	history, err := LoadHistory(filepath.Join(t.TempDir(), "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range historyMaxRuns + 5 {
+		history.Record(historyTestReport(start.AddDate(0, 0, i), "A"))
+	}
+
+	if len(history.Runs) != historyMaxRuns {
+		t.Errorf("Expected %d runs, got %d", historyMaxRuns, len(history.Runs))
+	}
+	if !history.Runs[0].Time.Equal(start.AddDate(0, 0, 5)) {
+		t.Errorf("Expected the oldest runs to be dropped, first run is from %v", history.Runs[0].Time)
+	}
+}
+
+func TestLoadHistoryErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte("[1, 2"), 0o600)
+	if _, err := LoadHistory(corrupt); err == nil || !strings.Contains(err.Error(), "parsing history") {
+		t.Errorf("Expected parse error, got: %v", err)
+	}
+
+	future := filepath.Join(dir, "future.json")
+	os.WriteFile(future, []byte(`{"version":99,"runs":[]}`), 0o600)
+	if _, err := LoadHistory(future); err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Errorf("Expected version error, got: %v", err)
+	}
+}
+
+func TestDefaultHistoryPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+
+	path, err := defaultHistoryPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "album2buy", "history.json") {
+		t.Errorf("Unexpected history path %s", path)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", dir)
+	path, err = defaultHistoryPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, ".local", "share", "album2buy", "history.json") {
+		t.Errorf("Unexpected fallback history path %s", path)
+	}
+}
+
+func TestDiffReport(t *testing.T) {
+	history, err := LoadHistory(filepath.Join(t.TempDir(), "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	history.Record(historyTestReport(march, "Skipped", "Returning"))
+	history.Record(historyTestReport(april, "Skipped", "Bought", "Dropped"))
+	history.Record(historyTestReport(may, "Skipped", "Bought", "Dropped"))
+
+	// "Returning" was left out in April, so its streak restarts
+	history.Runs[2].Recommendations = append(history.Runs[2].Recommendations, Recommendation{Artist: "Artist", Album: "Returning"})
+
+	report := historyTestReport(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), "Skipped", "Fresh", "Returning")
+	checker := &fakeChecker{owned: map[string]bool{"Bought": true}}
+	if err := diffReport(context.Background(), report, history, checker); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		status    string
+		firstSeen time.Time
+	}{
+		{statusStillMissing, march},
+		{statusNew, time.Time{}},
+		{statusStillMissing, may},
+	}
+	for i, want := range expected {
+		rec := report.Recommendations[i]
+		if rec.Status != want.status {
+			t.Errorf("%s: expected status %s, got %s", rec.Album, want.status, rec.Status)
+		}
+		if want.firstSeen.IsZero() != (rec.FirstSeen == nil) || (rec.FirstSeen != nil && !rec.FirstSeen.Equal(want.firstSeen)) {
+			t.Errorf("%s: expected first seen %v, got %v", rec.Album, want.firstSeen, rec.FirstSeen)
+		}
+	}
+
+	if len(report.Resolved) != 1 || report.Resolved[0].Album != "Bought" || report.Resolved[0].Status != statusResolved {
+		t.Errorf("Expected only 'Bought' to be resolved, got %+v", report.Resolved)
+	}
+	if checker.lookups != 2 {
+		t.Errorf("Expected the 2 albums that left the list to be looked up, got %d lookups", checker.lookups)
+	}
+}
+
+// albumRecorder is an AlbumChecker that owns the albums with a MusicBrainz ID and records the albums it checks
+type albumRecorder struct {
+	albums []Album
+}
+
+func (r *albumRecorder) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	r.albums = append(r.albums, album)
+	return album.MBID != "", nil
+}
+
+func TestDiffReportRechecksWithMBID(t *testing.T) {
+	history, err := LoadHistory(filepath.Join(t.TempDir(), "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const mbid = "b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"
+	previous := historyTestReport(time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), "Renamed")
+	previous.Recommendations[0].MBID = mbid
+	previous.Recommendations[0].Image = "https://img.example.com/large.png"
+	history.Record(previous)
+
+	checker := &albumRecorder{}
+	report := historyTestReport(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err := diffReport(context.Background(), report, history, checker); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Resolved) != 1 {
+		t.Errorf("Expected the album to be resolved by its MusicBrainz ID, got %+v", report.Resolved)
+	}
+	if len(checker.albums) != 1 || checker.albums[0].MBID != mbid || checker.albums[0].ImageURL() != "https://img.example.com/large.png" {
+		t.Errorf("Expected the recheck to keep the MusicBrainz ID and cover art, got %+v", checker.albums)
+	}
+}
+
+func TestDiffReportWithoutHistory(t *testing.T) {
+	history, err := LoadHistory(filepath.Join(t.TempDir(), "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := historyTestReport(time.Now(), "A")
+	if err := diffReport(context.Background(), report, history, &fakeChecker{}); err != nil {
+		t.Fatal(err)
+	}
+	if report.Recommendations[0].Status != statusNew {
+		t.Errorf("Expected every album to be new on the first run, got %s", report.Recommendations[0].Status)
+	}
+}
+
+func TestDiffOutput(t *testing.T) {
+	report := historyTestReport(time.Now(), "Fresh", "Skipped")
+	report.Period = "12month"
+	report.Recommendations[0].Status = statusNew
+	firstSeen := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	report.Recommendations[1].Status = statusStillMissing
+	report.Recommendations[1].FirstSeen = &firstSeen
+	report.Resolved = []Recommendation{{Rank: 4, Artist: "Artist", Album: "Bought", Status: statusResolved}}
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "text", report); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	for _, want := range []string{"Artist - Fresh  [NEW]", "Artist - Skipped  [STILL MISSING since 2025-03-01]", "RESOLVED SINCE LAST RUN\n✓ Artist - Bought"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in text output, got:\n%s", want, output)
+		}
+	}
+
+	buf.Reset()
+	if err := writeReport(&buf, "csv", report); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[3][2] != "Bought" || records[3][7] != statusResolved {
+		t.Errorf("Expected resolved album as last CSV row, got %v", records)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of ignore rules
+const (
+	ignoreURL    = "url"
+	ignoreArtist = "artist"
+	ignoreGlob   = "glob"
+	ignoreRegex  = "regex"
+)
+
+// IgnoreRule is a single line of the ignore file. Lines look like
+//
+//	https://www.last.fm/music/Artist/Album   # exact Last.fm URL
+//	artist: Some Artist                      # every album by the artist
+//	glob: *Original Game Soundtrack*         # wildcard pattern on "Artist - Album"
+//	regex: (?i)\blive\b                      # regular expression on "Artist - Album"
+//
+// where the text after " #" is an optional note explaining the rule. A rule ending in
+// snooze-until=YYYY-MM-DD only applies before that date, so the album comes back
+// on its own once the snooze expires.
+type IgnoreRule struct {
+	Line        int
+	Kind        string
+	Value       string
+	Note        string
+	SnoozeUntil time.Time // zero for permanent rules
+
+	pattern *regexp.Regexp // compiled glob or regex
+}
+
+// snoozePrefix introduces the expiry date of a snoozed ignore rule
+const snoozePrefix = "snooze-until="
+
+// IgnoreList is the parsed ignore file
+type IgnoreList struct {
+	Rules    []IgnoreRule
+	Warnings []string // malformed lines, as "line N: problem"
+
+	now func() time.Time
+}
+
+// loadIgnoreList reads the ignore file at filePath, reporting malformed lines as warnings on stderr.
+// A missing or unreadable file yields an empty list.
+func loadIgnoreList(filePath string) *IgnoreList {
+	if filePath == "" {
+		return &IgnoreList{now: time.Now} // No ignore file specified
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not open ignore file: %v\n", err)
+		return &IgnoreList{now: time.Now}
+	}
+	defer file.Close()
+
+	list, err := parseIgnoreList(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read ignore file: %v\n", err)
+	}
+	for _, warning := range list.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s:%s\n", filePath, warning)
+	}
+	return list
+}
+
+// parseIgnoreList parses ignore rules, skipping blank lines and # comments
+func parseIgnoreList(r io.Reader) (*IgnoreList, error) {
+	list := &IgnoreList{now: time.Now}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		rule, err := parseIgnoreRule(scanner.Text())
+		if err != nil {
+			list.Warnings = append(list.Warnings, fmt.Sprintf("line %d: %v", lineNum, err))
+			continue
+		}
+		if rule == nil {
+			continue
+		}
+		rule.Line = lineNum
+		list.Rules = append(list.Rules, *rule)
+	}
+	return list, scanner.Err()
+}
+
+// parseIgnoreRule parses a single line of the ignore file; blank lines and comments yield nil
+func parseIgnoreRule(line string) (*IgnoreRule, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	rule := &IgnoreRule{}
+	if i := strings.Index(line, " #"); i >= 0 {
+		rule.Note = strings.TrimSpace(line[i+2:])
+		line = strings.TrimSpace(line[:i])
+	}
+
+	if i := strings.LastIndexAny(line, " \t"); i >= 0 && strings.HasPrefix(line[i+1:], snoozePrefix) {
+		date := strings.TrimPrefix(line[i+1:], snoozePrefix)
+		until, err := time.ParseInLocation(time.DateOnly, date, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snooze date %q, expected YYYY-MM-DD", date)
+		}
+		rule.SnoozeUntil = until
+		line = strings.TrimSpace(line[:i])
+	}
+
+	if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+		rule.Kind, rule.Value = ignoreURL, line
+		return rule, nil
+	}
+
+	kind, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil, fmt.Errorf("expected a Last.fm URL or KIND: VALUE, got %q", line)
+	}
+	rule.Kind = strings.ToLower(strings.TrimSpace(kind))
+	rule.Value = strings.TrimSpace(value)
+	if rule.Value == "" {
+		return nil, fmt.Errorf("empty %s rule", rule.Kind)
+	}
+
+	var err error
+	switch rule.Kind {
+	case ignoreURL, ignoreArtist:
+	case ignoreGlob:
+		rule.pattern = globToRegexp(rule.Value)
+	case ignoreRegex:
+		if rule.pattern, err = regexp.Compile(rule.Value); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule kind %q (expected url, artist, glob or regex)", kind)
+	}
+	return rule, nil
+}
+
+// globToRegexp converts a case-insensitive wildcard pattern, where * matches any
+// text and ? a single character, into an anchored regular expression
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Snoozed reports whether the rule is a snooze
+func (r *IgnoreRule) Snoozed() bool {
+	return !r.SnoozeUntil.IsZero()
+}
+
+// Active reports whether the rule applies at the given time; snoozes expire at the start of their date
+func (r *IgnoreRule) Active(now time.Time) bool {
+	return !r.Snoozed() || now.Before(r.SnoozeUntil)
+}
+
+// Matches reports whether the rule ignores the album, regardless of snoozes
+func (r *IgnoreRule) Matches(album Album) bool {
+	switch r.Kind {
+	case ignoreURL:
+		return album.URL == r.Value
+	case ignoreArtist:
+		return strings.EqualFold(cleanString(album.Artist.Name), cleanString(r.Value))
+	default:
+		return r.pattern.MatchString(album.Artist.Name + " - " + album.Name)
+	}
+}
+
+// String formats the rule as a line of the ignore file
+func (r *IgnoreRule) String() string {
+	line := r.Value
+	if r.Kind != ignoreURL {
+		line = r.Kind + ": " + r.Value
+	}
+	if r.Snoozed() {
+		line += " " + snoozePrefix + r.SnoozeUntil.Format(time.DateOnly)
+	}
+	if r.Note != "" {
+		line += " # " + r.Note
+	}
+	return line
+}
+
+// Match returns the active rule that ignores the album, or nil. Permanent rules take
+// precedence over snoozes, so an album is only reported as snoozed if nothing else ignores it.
+func (l *IgnoreList) Match(album Album) *IgnoreRule {
+	now := l.now()
+	var snooze *IgnoreRule
+	for i := range l.Rules {
+		rule := &l.Rules[i]
+		if !rule.Active(now) || !rule.Matches(album) {
+			continue
+		}
+		if !rule.Snoozed() {
+			return rule
+		}
+		if snooze == nil {
+			snooze = rule
+		}
+	}
+	return snooze
+}
+
+// HasURL reports whether the list has a rule for exactly this Last.fm URL
+func (l *IgnoreList) HasURL(url string) bool {
+	for _, rule := range l.Rules {
+		if rule.Kind == ignoreURL && rule.Value == url {
+			return true
+		}
+	}
+	return false
+}
+
+// editIgnoreFile applies edit to the lines of the ignore file and writes the result back
+// atomically, keeping the file's permissions, so a crash never leaves a truncated file.
+// A missing file is edited as an empty one.
+func editIgnoreFile(path string, edit func(lines []string) []string) error {
+	perm := fs.FileMode(0o644)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("failed to read ignore file: %w", err)
+	}
+
+	var lines []string
+	if content := strings.TrimSuffix(string(data), "\n"); content != "" {
+		lines = strings.Split(content, "\n")
+	}
+	lines = edit(lines)
+
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	if err := writeFileAtomic(path, []byte(content), perm); err != nil {
+		return fmt.Errorf("failed to write ignore file: %w", err)
+	}
+	return nil
+}
+
+// removeLines returns lines without the given 1-based line numbers
+func removeLines(lines []string, remove map[int]bool) []string {
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if !remove[i+1] {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
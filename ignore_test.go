@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadIgnoreListNoFile(t *testing.T) {
+	list := loadIgnoreList("")
+	if len(list.Rules) != 0 || len(list.Warnings) != 0 {
+		t.Errorf("Expected empty list, got %+v", list)
+	}
+}
+
+func TestLoadIgnoreListURLs(t *testing.T) {
+	content := "https://www.last.fm/music/Artist1/Album1\nhttps://www.last.fm/music/Artist2/Album2\n\n\nhttps://www.last.fm/music/Artist3/Album3"
+	path := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list := loadIgnoreList(path)
+	expected := []string{
+		"https://www.last.fm/music/Artist1/Album1",
+		"https://www.last.fm/music/Artist2/Album2",
+		"https://www.last.fm/music/Artist3/Album3",
+	}
+
+	if len(list.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(list.Rules))
+	}
+	for i, rule := range list.Rules {
+		if rule.Kind != ignoreURL || rule.Value != expected[i] {
+			t.Errorf("Expected URL rule %s, got %s %s", expected[i], rule.Kind, rule.Value)
+		}
+	}
+	if list.Rules[2].Line != 5 {
+		t.Errorf("Expected third rule on line 5, got %d", list.Rules[2].Line)
+	}
+}
+
+func TestParseIgnoreList(t *testing.T) {
+	content := `# Albums I will never buy
+https://www.last.fm/music/Artist1/Album1 # bought on vinyl
+artist: Jeremy Soule   # game music is streamed
+glob: *Original Game Soundtrack*
+regex: (?i)\blive\b # no live albums
+URL: https://www.last.fm/music/Artist2/Album2
+`
+	list, err := parseIgnoreList(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", list.Warnings)
+	}
+
+	expected := []IgnoreRule{
+		{Line: 2, Kind: ignoreURL, Value: "https://www.last.fm/music/Artist1/Album1", Note: "bought on vinyl"},
+		{Line: 3, Kind: ignoreArtist, Value: "Jeremy Soule", Note: "game music is streamed"},
+		{Line: 4, Kind: ignoreGlob, Value: "*Original Game Soundtrack*"},
+		{Line: 5, Kind: ignoreRegex, Value: `(?i)\blive\b`, Note: "no live albums"},
+		{Line: 6, Kind: ignoreURL, Value: "https://www.last.fm/music/Artist2/Album2"},
+	}
+	if len(list.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(list.Rules))
+	}
+	for i, want := range expected {
+		got := list.Rules[i]
+		if got.Line != want.Line || got.Kind != want.Kind || got.Value != want.Value || got.Note != want.Note {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestParseIgnoreListWarnings(t *testing.T) {
+	content := `https://www.last.fm/music/Artist1/Album1
+just some text
+regex: ([unclosed
+color: blue
+artist:
+`
+	list, err := parseIgnoreList(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Rules) != 1 {
+		t.Errorf("Expected only the valid rule to be kept, got %+v", list.Rules)
+	}
+
+	expected := []string{
+		"line 2: expected a Last.fm URL",
+		"line 3: invalid regex",
+		`line 4: unknown rule kind "color"`,
+		"line 5: empty artist rule",
+	}
+	if len(list.Warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %v", len(expected), list.Warnings)
+	}
+	for i, want := range expected {
+		if !strings.HasPrefix(list.Warnings[i], want) {
+			t.Errorf("Expected warning starting with %q, got %q", want, list.Warnings[i])
+		}
+	}
+}
+
+func TestIgnoreListMatch(t *testing.T) {
+	list, err := parseIgnoreList(strings.NewReader(`https://www.last.fm/music/Artist1/Album1
+artist: Jeremy Soule
+glob: *original game soundtrack*
+glob: Poppy - ?
+regex: \bLive\b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		artist, name, url string
+		expected          int // line of the matching rule, 0 for none
+	}{
+		{"Artist1", "Album1", "https://www.last.fm/music/Artist1/Album1", 1},
+		{"Artist1", "Album2", "https://www.last.fm/music/Artist1/Album2", 0},
+		{"jeremy soule", "Oblivion", "", 2},
+		{"Chris Haigh", "Skyrim (Original Game Soundtrack)", "", 3},
+		{"Poppy", "I", "", 4},
+		{"Poppy", "Zig", "", 0},
+		{"Band", "Live at Wembley", "", 5},
+		{"Band", "Alive", "", 0},
+		{"Band", "live at home", "", 0},
+	}
+
+	for _, tt := range tests {
+		album := testAlbum(tt.artist, tt.name)
+		album.URL = tt.url
+		rule := list.Match(album)
+		line := 0
+		if rule != nil {
+			line = rule.Line
+		}
+		if line != tt.expected {
+			t.Errorf("%s - %s: expected rule on line %d, got %d", tt.artist, tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestIgnoreRuleString(t *testing.T) {
+	tests := []struct {
+		rule     IgnoreRule
+		expected string
+	}{
+		{IgnoreRule{Kind: ignoreURL, Value: "https://www.last.fm/music/A/B"}, "https://www.last.fm/music/A/B"},
+		{IgnoreRule{Kind: ignoreArtist, Value: "A", Note: "why"}, "artist: A # why"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.String(); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestParseIgnoreListSnooze(t *testing.T) {
+	list, err := parseIgnoreList(strings.NewReader(`https://www.last.fm/music/A/B snooze-until=2027-01-01 # maybe after the tour
+artist: Poppy snooze-until=2025-02-30
+glob: *Deluxe*	snooze-until=2026-06-01
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %+v", list.Rules)
+	}
+	rule := list.Rules[0]
+	if rule.Value != "https://www.last.fm/music/A/B" || rule.Note != "maybe after the tour" {
+		t.Errorf("Unexpected snoozed rule %+v", rule)
+	}
+	if rule.SnoozeUntil.Format(time.DateOnly) != "2027-01-01" {
+		t.Errorf("Expected snooze until 2027-01-01, got %v", rule.SnoozeUntil)
+	}
+	if list.Rules[1].Kind != ignoreGlob || list.Rules[1].Value != "*Deluxe*" || !list.Rules[1].Snoozed() {
+		t.Errorf("Expected snoozed glob rule, got %+v", list.Rules[1])
+	}
+	if rule.String() != "https://www.last.fm/music/A/B snooze-until=2027-01-01 # maybe after the tour" {
+		t.Errorf("Unexpected rule line %q", rule.String())
+	}
+
+	if len(list.Warnings) != 1 || !strings.HasPrefix(list.Warnings[0], `line 2: invalid snooze date "2025-02-30"`) {
+		t.Errorf("Expected warning about the invalid date, got %v", list.Warnings)
+	}
+}
+
+func TestIgnoreListSnoozeExpiry(t *testing.T) {
+	list, err := parseIgnoreList(strings.NewReader("artist: Poppy snooze-until=2026-01-01\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	album := testAlbum("Poppy", "Zig")
+
+	list.now = func() time.Time { return time.Date(2025, 12, 31, 23, 59, 0, 0, time.Local) }
+	if rule := list.Match(album); rule == nil || !rule.Snoozed() {
+		t.Error("Expected the album to be snoozed before the date")
+	}
+
+	list.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local) }
+	if rule := list.Match(album); rule != nil {
+		t.Errorf("Expected the snooze to expire on its date, matched line %d", rule.Line)
+	}
+}
+
+func TestIgnoreListPermanentRuleBeatsSnooze(t *testing.T) {
+	list, err := parseIgnoreList(strings.NewReader("artist: Poppy snooze-until=2999-01-01\nglob: Poppy - *\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := list.Match(testAlbum("Poppy", "Zig"))
+	if rule == nil || rule.Snoozed() {
+		t.Errorf("Expected the permanent rule to match, got %+v", rule)
+	}
+}
+
+func TestFindMissingAlbumsCountsSnoozes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{}}}`))
+	}))
+	defer server.Close()
+
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	content := "artist: Snoozed snooze-until=2999-01-01\nartist: Expired snooze-until=2000-01-01\nartist: Ignored\n"
+	if err := os.WriteFile(ignoreFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	albums := []Album{
+		testAlbum("Snoozed", "One"),
+		testAlbum("Snoozed", "Two"),
+		testAlbum("Expired", "Three"),
+		testAlbum("Ignored", "Four"),
+	}
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass")
+	result := mustFindMissingAlbums(t, subsonicClient, albums, &Config{IgnoreFile: ignoreFile}, 0)
+
+	if result.Snoozed != 2 || result.Ignored != 1 {
+		t.Errorf("Expected 2 snoozed and 1 ignored album, got %d and %d", result.Snoozed, result.Ignored)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].Name != "Three" {
+		t.Errorf("Expected the album with the expired snooze to be missing, got %v", result.Missing)
+	}
+
+	var buf bytes.Buffer
+	if err := printRecommendation(&buf, newReport(&Config{LastFMPeriod: "12month"}, result)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "2 albums are snoozed in the ignore file") {
+		t.Errorf("Expected snooze summary, got: %s", buf.String())
+	}
+}
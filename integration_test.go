@@ -3,34 +3,58 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+// albumSlice is an AlbumSource that yields a fixed list of albums as a single batch
+type albumSlice struct {
+	albums []Album
+	done   bool
+}
+
+func (s *albumSlice) NextAlbums(ctx context.Context) ([]Album, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return s.albums, nil
+}
+
+func (s *albumSlice) Total() int {
+	return len(s.albums)
+}
+
+// mustFindMissingAlbums runs findMissingAlbums over a fixed list of albums
+func mustFindMissingAlbums(t *testing.T, subsonicClient *SubsonicClient, albums []Album, cfg *Config, limit int) *CheckResult {
+	t.Helper()
+	result, err := findMissingAlbums(context.Background(), subsonicClient, &albumSlice{albums: albums}, cfg, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
 func TestFindMissingAlbumsIntegration(t *testing.T) {
 	subsonicMockResponse := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{
+				Album: []SubsonicAlbum{
 					{Title: "Existing Album", Artist: "Existing Artist"},
 				},
 			},
@@ -46,7 +70,7 @@ func TestFindMissingAlbumsIntegration(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	subsonicClient := &SubsonicClient{
 		httpClient: httpClient,
 		server:     server.URL,
@@ -78,8 +102,7 @@ func TestFindMissingAlbumsIntegration(t *testing.T) {
 		},
 	}
 	
-	ctx := context.Background()
-	missing := findMissingAlbums(ctx, subsonicClient, albums)
+	missing := mustFindMissingAlbums(t, subsonicClient, albums, &Config{}, maxRecommendations).Missing
 	
 	if len(missing) != 2 {
 		t.Errorf("Expected 2 missing albums, got %d", len(missing))
@@ -98,22 +121,13 @@ func TestFindMissingAlbumsWithIgnoredURLs(t *testing.T) {
 	subsonicMockResponse := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{},
+				Album: []SubsonicAlbum{},
 			},
 		},
 	}
@@ -127,7 +141,7 @@ func TestFindMissingAlbumsWithIgnoredURLs(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	subsonicClient := &SubsonicClient{
 		httpClient: httpClient,
 		server:     server.URL,
@@ -165,18 +179,12 @@ func TestFindMissingAlbumsWithIgnoredURLs(t *testing.T) {
 	}
 	tmpFile.Close()
 	
-	originalIgnoreFile := os.Getenv("IGNORE_FILE")
-	os.Setenv("IGNORE_FILE", tmpFile.Name())
-	defer func() {
-		if originalIgnoreFile == "" {
-			os.Unsetenv("IGNORE_FILE")
-		} else {
-			os.Setenv("IGNORE_FILE", originalIgnoreFile)
-		}
-	}()
-	
-	ctx := context.Background()
-	missing := findMissingAlbums(ctx, subsonicClient, albums)
+	result := mustFindMissingAlbums(t, subsonicClient, albums, &Config{IgnoreFile: tmpFile.Name()}, maxRecommendations)
+	missing := result.Missing
+
+	if result.Ignored != 1 {
+		t.Errorf("Expected 1 ignored album, got %d", result.Ignored)
+	}
 	
 	if len(missing) != 1 {
 		t.Errorf("Expected 1 missing album (after ignoring), got %d", len(missing))
@@ -191,22 +199,13 @@ func TestFindMissingAlbumsMaxRecommendations(t *testing.T) {
 	subsonicMockResponse := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{},
+				Album: []SubsonicAlbum{},
 			},
 		},
 	}
@@ -220,7 +219,7 @@ func TestFindMissingAlbumsMaxRecommendations(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	subsonicClient := &SubsonicClient{
 		httpClient: httpClient,
 		server:     server.URL,
@@ -239,8 +238,7 @@ func TestFindMissingAlbumsMaxRecommendations(t *testing.T) {
 		})
 	}
 	
-	ctx := context.Background()
-	missing := findMissingAlbums(ctx, subsonicClient, albums)
+	missing := mustFindMissingAlbums(t, subsonicClient, albums, &Config{}, maxRecommendations).Missing
 	
 	if len(missing) != maxRecommendations {
 		t.Errorf("Expected %d missing albums (max recommendations), got %d", maxRecommendations, len(missing))
@@ -272,22 +270,13 @@ func TestEndToEndWorkflow(t *testing.T) {
 	subsonicResponseWithAlbum := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{
+				Album: []SubsonicAlbum{
 					{Title: "Album in Library", Artist: "Artist in Library"},
 				},
 			},
@@ -297,22 +286,13 @@ func TestEndToEndWorkflow(t *testing.T) {
 	subsonicResponseEmpty := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{},
+				Album: []SubsonicAlbum{},
 			},
 		},
 	}
@@ -342,7 +322,7 @@ func TestEndToEndWorkflow(t *testing.T) {
 	}))
 	defer subsonicServer.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	lastFMClient := &LastFMClient{
 		httpClient: httpClient,
 		apiKey:     "test-key",
@@ -358,7 +338,7 @@ func TestEndToEndWorkflow(t *testing.T) {
 	
 	ctx := context.Background()
 	
-	albums, err := lastFMClient.GetTopAlbums(ctx, "testuser", 10)
+	albums, err := lastFMClient.GetTopAlbums(ctx, "testuser", "12month", 10)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -367,7 +347,7 @@ func TestEndToEndWorkflow(t *testing.T) {
 		t.Errorf("Expected 2 albums from Last.fm, got %d", len(albums))
 	}
 	
-	missing := findMissingAlbums(ctx, subsonicClient, albums)
+	missing := mustFindMissingAlbums(t, subsonicClient, albums, &Config{}, maxRecommendations).Missing
 	
 	if len(missing) != 1 {
 		t.Errorf("Expected 1 missing album, got %d", len(missing))
@@ -380,4 +360,283 @@ func TestEndToEndWorkflow(t *testing.T) {
 	if missing[0].Artist.Name != "Missing Artist" {
 		t.Errorf("Expected missing artist 'Missing Artist', got '%s'", missing[0].Artist.Name)
 	}
-}
\ No newline at end of file
+}
+
+func TestFindMissingAlbumsNoLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"subsonic-response":{"searchResult3":{}}}`))
+	}))
+	defer server.Close()
+
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+
+	albums := []Album{}
+	for i := 0; i < maxRecommendations*2; i++ {
+		album := Album{Name: fmt.Sprintf("Missing Album %d", i+1)}
+		album.Artist.Name = "Missing Artist"
+		albums = append(albums, album)
+	}
+
+	result := mustFindMissingAlbums(t, subsonicClient, albums, &Config{}, 0)
+
+	if len(result.Missing) != len(albums) {
+		t.Errorf("Expected all %d albums to be reported missing, got %d", len(albums), len(result.Missing))
+	}
+
+	if result.Stats.Total != len(albums) || result.Stats.Successful != len(albums) {
+		t.Errorf("Expected %d successful checks, got %+v", len(albums), result.Stats)
+	}
+}
+
+func TestFindMissingAlbumsStopsPagingEarly(t *testing.T) {
+	requests := 0
+	lastFMServer := newPagedLastFMServer(t, 2000, &requests)
+	defer lastFMServer.Close()
+
+	subsonicServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every album is owned except number 600 on the second page
+		albums := `[{"name":"` + r.URL.Query().Get("query") + `","artist":"Artist"}]`
+		if r.URL.Query().Get("query") == "Album 600" {
+			albums = `[]`
+		}
+		w.Write([]byte(`{"subsonic-response":{"searchResult3":{"album":` + albums + `}}}`))
+	}))
+	defer subsonicServer.Close()
+
+	httpClient := newHTTPClient(false)
+	lastFMClient := &LastFMClient{httpClient: httpClient, apiKey: "test-key", baseURL: lastFMServer.URL + "/"}
+	subsonicClient := NewSubsonicClient(httpClient, subsonicServer.URL, "testuser", "testpass")
+
+	pager := lastFMClient.NewTopAlbumPager("testuser", "12month", 0)
+	result, err := findMissingAlbums(context.Background(), subsonicClient, pager, &Config{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Missing) != 1 || result.Missing[0].Name != "Album 600" {
+		t.Fatalf("Expected 'Album 600' to be missing, got %v", result.Missing)
+	}
+	if requests != 2 {
+		t.Errorf("Expected paging to stop after 2 of 4 pages, got %d requests", requests)
+	}
+	if result.Albums != 600 {
+		t.Errorf("Expected 600 albums examined, got %d", result.Albums)
+	}
+}
+
+func TestFindMissingAlbumsConcurrentPreservesOrder(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		query := r.URL.Query().Get("query")
+		var n int
+		fmt.Sscanf(query, "Album %d", &n)
+		// Later albums answer faster, so completion order is the reverse of Last.fm order
+		time.Sleep(time.Duration(20-n) * time.Millisecond)
+
+		switch {
+		case n%5 == 0:
+			w.Write([]byte(`{"subsonic-response":{"status":"failed","error":{"code":0,"message":"broken"}}}`))
+		case n%3 == 0:
+			w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{"album":[{"name":"` + query + `","artist":"Artist"}]}}}`))
+		default:
+			w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{}}}`))
+		}
+	}))
+	defer server.Close()
+
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+
+	albums := []Album{}
+	for i := 1; i <= 18; i++ {
+		album := Album{Name: fmt.Sprintf("Album %d", i), URL: fmt.Sprintf("https://www.last.fm/music/Artist/Album+%d", i)}
+		album.Artist.Name = "Artist"
+		albums = append(albums, album)
+	}
+
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(ignoreFile, []byte(albums[0].URL+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := mustFindMissingAlbums(t, subsonicClient, albums, &Config{Workers: 4, IgnoreFile: ignoreFile}, 0)
+
+	var names []string
+	for _, album := range result.Missing {
+		names = append(names, album.Name)
+	}
+	expected := "Album 2,Album 4,Album 7,Album 8,Album 11,Album 13,Album 14,Album 16,Album 17"
+	if got := strings.Join(names, ","); got != expected {
+		t.Errorf("Expected missing albums in Last.fm order\n%s\ngot\n%s", expected, got)
+	}
+
+	if result.Albums != 18 || result.Ignored != 1 {
+		t.Errorf("Expected 18 albums examined and 1 ignored, got %d and %d", result.Albums, result.Ignored)
+	}
+	if result.Stats.Total != 17 || result.Stats.Successful != 14 || result.Stats.Failed != 3 {
+		t.Errorf("Unexpected stats: %+v", result.Stats)
+	}
+	if maxInFlight > 4 {
+		t.Errorf("Expected at most 4 concurrent lookups, got %d", maxInFlight)
+	}
+}
+
+func TestFindMissingAlbumsConcurrentStopsEarly(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query().Get("query"))
+		mu.Unlock()
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{}}}`))
+	}))
+	defer server.Close()
+
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+
+	albums := []Album{}
+	for i := 1; i <= 100; i++ {
+		album := Album{Name: fmt.Sprintf("Album %d", i)}
+		album.Artist.Name = "Artist"
+		albums = append(albums, album)
+	}
+
+	result := mustFindMissingAlbums(t, subsonicClient, albums, &Config{Workers: 3}, 2)
+
+	if len(result.Missing) != 2 || result.Missing[0].Name != "Album 1" || result.Missing[1].Name != "Album 2" {
+		t.Fatalf("Expected the first two albums to be missing, got %v", result.Missing)
+	}
+	if result.Albums != 2 || result.Stats.Total != 2 {
+		t.Errorf("Expected only the first 2 albums to be counted, got %d albums and %+v", result.Albums, result.Stats)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(queries) > 2+3 {
+		t.Errorf("Expected lookups to stop shortly after the limit, got %d requests", len(queries))
+	}
+}
+
+func TestFindMissingAlbumsCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{}}}`))
+	}))
+	defer server.Close()
+
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+
+	albums := []Album{}
+	for i := 1; i <= 20; i++ {
+		album := Album{Name: fmt.Sprintf("Album %d", i)}
+		album.Artist.Name = "Artist"
+		albums = append(albums, album)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	finished := make(chan error, 1)
+	var result *CheckResult
+	go func() {
+		var err error
+		result, err = findMissingAlbums(ctx, subsonicClient, &albumSlice{albums: albums}, &Config{Workers: 2}, 0)
+		finished <- err
+	}()
+
+	select {
+	case err := <-finished:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected the deadline to end the scan, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Scan did not return after its context was cancelled")
+	}
+	if result.Stats.Failed != 0 || result.Stats.Network != 0 {
+		t.Errorf("Expected cancelled lookups not to count as failures, got %+v", result.Stats)
+	}
+}
+
+func TestAlbumScannerResumes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{}}}`))
+	}))
+	defer server.Close()
+
+	var albums []Album
+	for i := 1; i <= 10; i++ {
+		album := Album{Name: fmt.Sprintf("Album %d", i)}
+		album.Artist.Name = "Artist"
+		albums = append(albums, album)
+	}
+
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+	scanner := newAlbumScanner(subsonicClient, &albumSlice{albums: albums}, &Config{Workers: 3})
+	result := &CheckResult{}
+
+	for _, want := range []int{3, 6, 10} {
+		limit := 3
+		if want == 10 {
+			limit = 0
+		}
+		if err := scanner.Scan(context.Background(), result, limit); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Missing) != want || result.Albums != want {
+			t.Fatalf("Expected %d missing albums, got %d of %d examined", want, len(result.Missing), result.Albums)
+		}
+	}
+
+	for i, album := range result.Missing {
+		if album.Name != fmt.Sprintf("Album %d", i+1) {
+			t.Errorf("Expected Album %d at position %d, got %s", i+1, i, album.Name)
+		}
+	}
+	if !scanner.Exhausted() {
+		t.Error("Expected the scanner to be exhausted")
+	}
+}
+
+func TestFindMissingAlbumsCountsMatches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{"album":[
+			{"name":"Tagged (Remastered)","artist":"Artist","musicBrainzId":"b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"},
+			{"name":"Untagged","artist":"Artist"}]}}}`))
+	}))
+	defer server.Close()
+
+	var albums []Album
+	for _, name := range []string{"Tagged", "Untagged", "Missing"} {
+		album := Album{Name: name}
+		album.Artist.Name = "Artist"
+		albums = append(albums, album)
+	}
+	albums[0].MBID = "B1F0D4A8-0F7A-4C7E-9D3F-6C4F0B8D2E11"
+
+	subsonicClient := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+	result := mustFindMissingAlbums(t, subsonicClient, albums, &Config{}, 0)
+
+	if len(result.Missing) != 1 || result.Missing[0].Name != "Missing" {
+		t.Errorf("Expected only Missing to be missing, got %v", result.Missing)
+	}
+	if result.Matches != (MatchStats{MBID: 1, Name: 1}) {
+		t.Errorf("Expected one match by MusicBrainz ID and one by name, got %+v", result.Matches)
+	}
+}
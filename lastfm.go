@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// lastFMPeriods maps the Last.fm time periods to a human readable description
+var lastFMPeriods = map[string]string{
+	"overall": "all time",
+	"7day":    "last 7 days",
+	"1month":  "last month",
+	"3month":  "last 3 months",
+	"6month":  "last 6 months",
+	"12month": "last 12 months",
+}
+
+// Album represents a music album from Last.fm API response
+type Album struct {
+	Name   string `json:"name"`
+	Artist struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	URL       string       `json:"url"`
+	MBID      string       `json:"mbid"`
+	PlayCount flexInt      `json:"playcount"`
+	Image     []AlbumImage `json:"image"`
+	Attr      struct {
+		Rank flexInt `json:"rank"`
+	} `json:"@attr"`
+
+	// Score is the album's recommendation score, set by a Scorer
+	Score float64 `json:"-"`
+
+	// Songs and Tracks tell how many of the tracks of a partially owned album are in the library
+	Songs  int `json:"-"`
+	Tracks int `json:"-"`
+}
+
+// AlbumImage represents one size of an album's cover art in the Last.fm API response
+type AlbumImage struct {
+	URL  string `json:"#text"`
+	Size string `json:"size"`
+}
+
+// ImageURL returns the URL of the largest available cover art, or an empty string if there is none
+func (a Album) ImageURL() string {
+	// Last.fm lists the sizes from small to extralarge
+	for i := len(a.Image) - 1; i >= 0; i-- {
+		if a.Image[i].URL != "" {
+			return a.Image[i].URL
+		}
+	}
+	return ""
+}
+
+// flexInt decodes integers that Last.fm sends either as JSON numbers or as strings
+type flexInt int
+
+// UnmarshalJSON accepts both 42 and "42"
+func (f *flexInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s: %w", data, err)
+	}
+	*f = flexInt(n)
+	return nil
+}
+
+// PageInfo represents the paging metadata (@attr) of a Last.fm list response
+type PageInfo struct {
+	Page       flexInt `json:"page"`
+	PerPage    flexInt `json:"perPage"`
+	TotalPages flexInt `json:"totalPages"`
+	Total      flexInt `json:"total"`
+}
+
+// Topalbums represents the top albums section of Last.fm API response
+type Topalbums struct {
+	Album []Album  `json:"album"`
+	Attr  PageInfo `json:"@attr"`
+}
+
+// LastFMResponse represents the complete Last.fm API response structure
+type LastFMResponse struct {
+	Topalbums Topalbums `json:"topalbums"`
+}
+
+// Track represents a track from the Last.fm API
+type Track struct {
+	Name   string `json:"name"`
+	Artist struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	URL       string  `json:"url"`
+	MBID      string  `json:"mbid"`
+	PlayCount flexInt `json:"playcount"`
+	Attr      struct {
+		Rank flexInt `json:"rank"`
+	} `json:"@attr"`
+}
+
+// TrackInfo represents the track.getInfo response of the Last.fm API. Album is empty
+// for tracks Last.fm knows no album of.
+type TrackInfo struct {
+	Name   string `json:"name"`
+	MBID   string `json:"mbid"`
+	URL    string `json:"url"`
+	Artist struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	Album struct {
+		Artist string       `json:"artist"`
+		Title  string       `json:"title"`
+		MBID   string       `json:"mbid"`
+		URL    string       `json:"url"`
+		Image  []AlbumImage `json:"image"`
+	} `json:"album"`
+}
+
+// AlbumInfo represents the album.getInfo response of the Last.fm API
+type AlbumInfo struct {
+	Name          string  `json:"name"`
+	Artist        string  `json:"artist"`
+	MBID          string  `json:"mbid"`
+	URL           string  `json:"url"`
+	PlayCount     flexInt `json:"playcount"`
+	UserPlayCount flexInt `json:"userplaycount"`
+	Tracks        struct {
+		Track oneOrMany[struct {
+			Name string `json:"name"`
+		}] `json:"track"`
+	} `json:"tracks"`
+}
+
+// oneOrMany decodes Last.fm lists, which are sent as a single object instead of
+// an array when they contain exactly one element
+type oneOrMany[T any] []T
+
+// UnmarshalJSON accepts both an array and a single object
+func (o *oneOrMany[T]) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var list []T
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		*o = list
+		return nil
+	}
+	if trimmed == "null" || trimmed == "" {
+		*o = nil
+		return nil
+	}
+
+	var single T
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	*o = []T{single}
+	return nil
+}
+
+// LastFMClient handles all Last.fm API operations
+type LastFMClient struct {
+	httpClient *HTTPClient
+	apiKey     string
+	baseURL    string
+}
+
+// NewLastFMClient creates a new Last.fm API client
+func NewLastFMClient(httpClient *HTTPClient, apiKey string) *LastFMClient {
+	return &LastFMClient{
+		httpClient: httpClient,
+		apiKey:     apiKey,
+		baseURL:    lastFMAPIURL,
+	}
+}
+
+// GetTopAlbums fetches up to limit of the user's top albums from Last.fm for the
+// given time period, walking as many pages as needed. A limit of 0 fetches every page.
+func (l *LastFMClient) GetTopAlbums(ctx context.Context, user, period string, limit int) ([]Album, error) {
+	pager := l.NewTopAlbumPager(user, period, limit)
+
+	var albums []Album
+	for {
+		page, err := pager.NextAlbums(ctx)
+		if err == io.EOF {
+			return albums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, page...)
+	}
+}
+
+// call invokes a Last.fm API method and decodes the JSON response into v
+func (l *LastFMClient) call(ctx context.Context, method string, params url.Values, v any) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("method", method)
+	params.Set("api_key", l.apiKey)
+	params.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", l.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := l.httpClient.DoWithRetry(ctx, req)
+	if err != nil {
+		return fmt.Errorf("Last.fm API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var apiErr struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != 0 {
+		return fmt.Errorf("Last.fm API error %d: %s", apiErr.Error, apiErr.Message)
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal Last.fm response: %w", err)
+	}
+	return nil
+}
+
+// getTopAlbumsPage fetches a single page of the user's top albums
+func (l *LastFMClient) getTopAlbumsPage(ctx context.Context, user, period string, page, limit int) (*Topalbums, error) {
+	if _, ok := lastFMPeriods[period]; !ok {
+		return nil, fmt.Errorf("unsupported Last.fm period %q", period)
+	}
+
+	params := url.Values{}
+	params.Set("user", user)
+	params.Set("period", period)
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("page", strconv.Itoa(page))
+
+	var lastFMResp LastFMResponse
+	if err := l.call(ctx, "user.gettopalbums", params, &lastFMResp); err != nil {
+		return nil, err
+	}
+
+	return &lastFMResp.Topalbums, nil
+}
+
+// GetAlbumInfo fetches an album's details including its track listing and the
+// user's play count of it
+func (l *LastFMClient) GetAlbumInfo(ctx context.Context, artist, album, user string) (*AlbumInfo, error) {
+	params := url.Values{}
+	params.Set("artist", artist)
+	params.Set("album", album)
+	params.Set("autocorrect", "1")
+	if user != "" {
+		params.Set("username", user)
+	}
+
+	var infoResp struct {
+		Album AlbumInfo `json:"album"`
+	}
+	if err := l.call(ctx, "album.getinfo", params, &infoResp); err != nil {
+		return nil, err
+	}
+
+	return &infoResp.Album, nil
+}
+
+// GetTrackInfo fetches a track's details including the album it appears on
+func (l *LastFMClient) GetTrackInfo(ctx context.Context, artist, track string) (*TrackInfo, error) {
+	params := url.Values{}
+	params.Set("artist", artist)
+	params.Set("track", track)
+	params.Set("autocorrect", "1")
+
+	var infoResp struct {
+		Track TrackInfo `json:"track"`
+	}
+	if err := l.call(ctx, "track.getinfo", params, &infoResp); err != nil {
+		return nil, err
+	}
+
+	return &infoResp.Track, nil
+}
+
+// GetTopTracks fetches up to limit of the user's top tracks for the given time
+// period, walking as many pages as needed. A limit of 0 fetches every page.
+func (l *LastFMClient) GetTopTracks(ctx context.Context, user, period string, limit int) ([]Track, error) {
+	pager := &lastFMPager[Track]{
+		fetch: func(ctx context.Context, page, pageSize int) ([]Track, PageInfo, error) {
+			return l.getTopTracksPage(ctx, user, period, page, pageSize)
+		},
+		rank:     func(track *Track) *flexInt { return &track.Attr.Rank },
+		maxItems: limit,
+	}
+
+	var tracks []Track
+	for {
+		page, err := pager.next(ctx)
+		if err == io.EOF {
+			return tracks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching top tracks: %w", err)
+		}
+		tracks = append(tracks, page...)
+	}
+}
+
+// getTopTracksPage fetches a single page of the user's top tracks
+func (l *LastFMClient) getTopTracksPage(ctx context.Context, user, period string, page, limit int) ([]Track, PageInfo, error) {
+	if _, ok := lastFMPeriods[period]; !ok {
+		return nil, PageInfo{}, fmt.Errorf("unsupported Last.fm period %q", period)
+	}
+
+	params := url.Values{}
+	params.Set("user", user)
+	params.Set("period", period)
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("page", strconv.Itoa(page))
+
+	var tracksResp struct {
+		TopTracks struct {
+			Track oneOrMany[Track] `json:"track"`
+			Attr  PageInfo         `json:"@attr"`
+		} `json:"toptracks"`
+	}
+	if err := l.call(ctx, "user.gettoptracks", params, &tracksResp); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return tracksResp.TopTracks.Track, tracksResp.TopTracks.Attr, nil
+}
+
+// AlbumSource yields Last.fm albums in batches
+type AlbumSource interface {
+	// NextAlbums returns the next batch of albums, or io.EOF once the source is exhausted
+	NextAlbums(ctx context.Context) ([]Album, error)
+	// Total returns the number of albums the source expects to yield, or 0 if not yet known
+	Total() int
+}
+
+// lastFMPager walks one of the user's Last.fm top lists one page at a time, numbering the
+// items Last.fm sends without a rank
+type lastFMPager[T any] struct {
+	fetch    func(ctx context.Context, page, pageSize int) ([]T, PageInfo, error)
+	rank     func(item *T) *flexInt // the rank field of an item
+	maxItems int                    // 0 walks every page
+	page     int
+	fetched  int
+	total    int
+	done     bool
+}
+
+// next fetches the next page, returning io.EOF once the last page or the item limit has
+// been reached
+func (p *lastFMPager[T]) next(ctx context.Context) ([]T, error) {
+	if p.done {
+		return nil, io.EOF
+	}
+
+	pageSize := lastFMPageSize
+	if p.maxItems > 0 && p.maxItems < pageSize {
+		pageSize = p.maxItems
+	}
+
+	// Use separate timeout for each Last.fm API call
+	pageCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	p.page++
+	items, info, err := p.fetch(pageCtx, p.page, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("fetching page %d: %w", p.page, err)
+	}
+
+	if p.maxItems > 0 && p.fetched+len(items) > p.maxItems {
+		items = items[:p.maxItems-p.fetched]
+	}
+	for i := range items {
+		if rank := p.rank(&items[i]); *rank == 0 {
+			*rank = flexInt(p.fetched + i + 1)
+		}
+	}
+	p.fetched += len(items)
+
+	p.total = int(info.Total)
+	if p.maxItems > 0 && p.total > p.maxItems {
+		p.total = p.maxItems
+	}
+
+	if len(items) == 0 || p.page >= int(info.TotalPages) ||
+		(p.maxItems > 0 && p.fetched >= p.maxItems) {
+		p.done = true
+	}
+	if len(items) == 0 {
+		return nil, io.EOF
+	}
+
+	return items, nil
+}
+
+// Total returns the number of items the pager expects to yield, once the first page is fetched
+func (p *lastFMPager[T]) Total() int {
+	if p.total < p.fetched {
+		return p.fetched
+	}
+	return p.total
+}
+
+// TopAlbumPager walks a user's top albums one Last.fm page at a time
+type TopAlbumPager struct {
+	lastFMPager[Album]
+}
+
+// NewTopAlbumPager creates a pager over the user's top albums that stops after
+// maxAlbums albums; a maxAlbums of 0 walks every page
+func (l *LastFMClient) NewTopAlbumPager(user, period string, maxAlbums int) *TopAlbumPager {
+	return &TopAlbumPager{lastFMPager[Album]{
+		fetch: func(ctx context.Context, page, pageSize int) ([]Album, PageInfo, error) {
+			topAlbums, err := l.getTopAlbumsPage(ctx, user, period, page, pageSize)
+			if err != nil {
+				return nil, PageInfo{}, err
+			}
+			return topAlbums.Album, topAlbums.Attr, nil
+		},
+		rank:     func(album *Album) *flexInt { return &album.Attr.Rank },
+		maxItems: maxAlbums,
+	}}
+}
+
+// NextAlbums fetches the next page of top albums, returning io.EOF once the
+// last page or the album limit has been reached
+func (p *TopAlbumPager) NextAlbums(ctx context.Context) ([]Album, error) {
+	return p.next(ctx)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// subsonicAlbumListPageSize is the largest page getAlbumList2 returns
+const subsonicAlbumListPageSize = 500
+
+// AlbumChecker reports whether a Last.fm album is present in the library
+type AlbumChecker interface {
+	HasAlbum(ctx context.Context, album Album) (bool, error)
+}
+
+// Ways in which an album can be found in the library
+const (
+	matchByMBID = "mbid"
+	matchByName = "name"
+)
+
+// AlbumMatch is the outcome of a library lookup
+type AlbumMatch struct {
+	Owned  bool
+	By     string // matchByMBID or matchByName for owned albums
+	ID     string // library album ID, if known
+	Songs  int    // songs of the library album, 0 if unknown
+	Tracks int    // tracks of the album on Last.fm, 0 unless compared by a TrackCountChecker
+}
+
+// Partial reports whether fewer songs of an owned album are in the library than it has tracks on Last.fm
+func (m AlbumMatch) Partial() bool {
+	return m.Owned && m.Songs > 0 && m.Songs < m.Tracks
+}
+
+// AlbumMatchChecker is an AlbumChecker that also tells how it found an album
+type AlbumMatchChecker interface {
+	AlbumChecker
+	MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error)
+}
+
+// matchAlbum looks up the album with checker; checkers that cannot tell how they
+// found an album are taken to match by name
+func matchAlbum(ctx context.Context, checker AlbumChecker, album Album) (AlbumMatch, error) {
+	if c, ok := checker.(AlbumMatchChecker); ok {
+		return c.MatchAlbum(ctx, album)
+	}
+	owned, err := checker.HasAlbum(ctx, album)
+	if !owned {
+		return AlbumMatch{}, err
+	}
+	return AlbumMatch{Owned: true, By: matchByName}, err
+}
+
+// MatchStats counts the albums found in the library by how they were matched
+type MatchStats struct {
+	MBID int `json:"mbid"`
+	Name int `json:"name"`
+}
+
+// add counts a lookup
+func (s *MatchStats) add(match AlbumMatch) {
+	switch match.By {
+	case matchByMBID:
+		s.MBID++
+	case matchByName:
+		s.Name++
+	}
+}
+
+// SubsonicAlbum represents an album entry of the Subsonic library
+type SubsonicAlbum struct {
+	ID            string `json:"id"`
+	Title         string `json:"name"`
+	Artist        string `json:"artist"`
+	SongCount     int    `json:"songCount"`
+	MusicBrainzID string `json:"musicBrainzId"` // OpenSubsonic servers only
+}
+
+// SubsonicAlbumListResponse represents the Subsonic getAlbumList2 response structure
+type SubsonicAlbumListResponse struct {
+	SubsonicResponse struct {
+		AlbumList2 struct {
+			Album []SubsonicAlbum `json:"album"`
+		} `json:"albumList2"`
+	} `json:"subsonic-response"`
+}
+
+// GetAlbumList returns one page of the library's albums sorted by name
+func (s *SubsonicClient) GetAlbumList(ctx context.Context, offset, size int) ([]SubsonicAlbum, error) {
+	params := url.Values{}
+	params.Set("type", "alphabeticalByName")
+	params.Set("size", strconv.Itoa(size))
+	params.Set("offset", strconv.Itoa(offset))
+
+	var listResp SubsonicAlbumListResponse
+	if err := s.get(ctx, "getAlbumList2.view", params, &listResp); err != nil {
+		return nil, err
+	}
+
+	return listResp.SubsonicResponse.AlbumList2.Album, nil
+}
+
+// LibraryIndex is an in-memory snapshot of every album in the Subsonic library,
+// answering lookups without further requests
+type LibraryIndex struct {
+	albums   map[string]matchCandidate
+	mbids    map[string]matchCandidate   // keyed by lower-case MusicBrainz ID, for the albums that have one
+	byArtist map[string][]matchCandidate // keyed by normalized artist, for inexact matching
+	matcher  *Matcher
+}
+
+// LoadLibraryIndex pages through the whole Subsonic album list and indexes it
+// by normalized artist and title, as normalized by the client's matcher
+func LoadLibraryIndex(ctx context.Context, client *SubsonicClient) (*LibraryIndex, error) {
+	index := &LibraryIndex{
+		albums:   make(map[string]matchCandidate),
+		mbids:    make(map[string]matchCandidate),
+		byArtist: make(map[string][]matchCandidate),
+		matcher:  client.matcher,
+	}
+
+	for offset := 0; ; offset += subsonicAlbumListPageSize {
+		albums, err := client.GetAlbumList(ctx, offset, subsonicAlbumListPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("fetching library albums at offset %d: %w", offset, err)
+		}
+
+		for _, candidate := range searchCandidates(albums) {
+			normalizer := index.matcher.normalizer()
+			index.add(index.albums, normalizer.Key(candidate.Artist, candidate.Title), candidate)
+			if candidate.MBID != "" {
+				index.add(index.mbids, strings.ToLower(candidate.MBID), candidate)
+			}
+			artist := normalizer.Artist(candidate.Artist)
+			index.byArtist[artist] = append(index.byArtist[artist], candidate)
+		}
+		if len(albums) < subsonicAlbumListPageSize {
+			return index, nil
+		}
+	}
+}
+
+// add indexes an album under key; of several albums with the same key, such as the same
+// album in two folders, the one with the most songs is kept
+func (l *LibraryIndex) add(albums map[string]matchCandidate, key string, candidate matchCandidate) {
+	if existing, ok := albums[key]; !ok || candidate.Songs > existing.Songs {
+		albums[key] = candidate
+	}
+}
+
+// Len returns the number of distinct albums in the index
+func (l *LibraryIndex) Len() int {
+	return len(l.albums)
+}
+
+// HasAlbum checks if a specific album exists in the indexed library
+func (l *LibraryIndex) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	match, err := l.MatchAlbum(ctx, album)
+	return match.Owned, err
+}
+
+// MatchAlbum looks the album up in the index, by MusicBrainz ID if it has one that is
+// in the library and by name otherwise
+func (l *LibraryIndex) MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error) {
+	if c, ok := l.mbids[strings.ToLower(album.MBID)]; ok && album.MBID != "" {
+		return AlbumMatch{Owned: true, By: matchByMBID, ID: c.ID, Songs: c.Songs}, nil
+	}
+
+	artists, title := l.matcher.artistNames(album.Artist.Name), l.matcher.normalizer().Title(album.Name)
+	for _, artist := range artists {
+		if c, ok := l.albums[artist+"\x00"+title]; ok {
+			return AlbumMatch{Owned: true, By: matchByName, ID: c.ID, Songs: c.Songs}, nil
+		}
+	}
+	if l.matcher.threshold() == 1 {
+		return AlbumMatch{}, nil
+	}
+
+	// Only albums of similar enough artists can reach the threshold
+	var candidates []matchCandidate
+	for name, albums := range l.byArtist {
+		if artistSimilarity(artists, name) >= l.matcher.threshold() {
+			candidates = append(candidates, albums...)
+		}
+	}
+	return l.matcher.Match(album, candidates), nil
+}
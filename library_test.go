@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newAlbumListServer serves a library of total albums through getAlbumList2, recording the requested offsets
+func newAlbumListServer(t *testing.T, total int, offsets *[]int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/rest/getAlbumList2.view") {
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("type") != "alphabeticalByName" {
+			t.Errorf("Expected type=alphabeticalByName, got %s", r.URL.Query().Get("type"))
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		*offsets = append(*offsets, offset)
+
+		var albums []string
+		for i := offset; i < min(offset+size, total); i++ {
+			albums = append(albums, fmt.Sprintf(`{"id":"%d","name":"Album %d (Remastered)","artist":"The Artist","songCount":10}`, i, i))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"subsonic-response":{"status":"ok","albumList2":{"album":[%s]}}}`, strings.Join(albums, ","))
+	}))
+}
+
+func TestLoadLibraryIndexPages(t *testing.T) {
+	var offsets []int
+	server := newAlbumListServer(t, 1200, &offsets)
+	defer server.Close()
+
+	index, err := LoadLibraryIndex(context.Background(), NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index.Len() != 1200 {
+		t.Errorf("Expected 1200 indexed albums, got %d", index.Len())
+	}
+	if fmt.Sprint(offsets) != "[0 500 1000]" {
+		t.Errorf("Expected offsets [0 500 1000], got %v", offsets)
+	}
+}
+
+func TestLoadLibraryIndexExactPage(t *testing.T) {
+	var offsets []int
+	server := newAlbumListServer(t, 500, &offsets)
+	defer server.Close()
+
+	index, err := LoadLibraryIndex(context.Background(), NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index.Len() != 500 || len(offsets) != 2 {
+		t.Errorf("Expected 500 albums from 2 requests, got %d from %d", index.Len(), len(offsets))
+	}
+}
+
+func TestLoadLibraryIndexError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"subsonic-response":{"status":"failed","error":{"code":40,"message":"Wrong username or password"}}}`))
+	}))
+	defer server.Close()
+
+	_, err := LoadLibraryIndex(context.Background(), NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass"))
+	if err == nil || !strings.Contains(err.Error(), "Wrong username or password") {
+		t.Errorf("Expected Subsonic error, got: %v", err)
+	}
+}
+
+func TestLibraryIndexHasAlbum(t *testing.T) {
+	var offsets []int
+	server := newAlbumListServer(t, 3, &offsets)
+	defer server.Close()
+
+	index, err := LoadLibraryIndex(context.Background(), NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		artist   string
+		album    string
+		expected bool
+	}{
+		{"The Artist", "Album 1", true},
+		{"the artist", "ALBUM 2 (Deluxe)", true},
+		{"The Artist", "Album 3", false},
+		{"Other Artist", "Album 1", false},
+	}
+
+	for _, tt := range tests {
+		album := Album{Name: tt.album}
+		album.Artist.Name = tt.artist
+		exists, err := index.HasAlbum(context.Background(), album)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != tt.expected {
+			t.Errorf("%s - %s: expected %v, got %v", tt.artist, tt.album, tt.expected, exists)
+		}
+	}
+}
+
+func TestFindMissingAlbumsWithLibraryIndex(t *testing.T) {
+	var offsets []int
+	server := newAlbumListServer(t, 2, &offsets)
+	defer server.Close()
+
+	index, err := LoadLibraryIndex(context.Background(), NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var albums []Album
+	for i := range 4 {
+		album := Album{Name: fmt.Sprintf("Album %d", i)}
+		album.Artist.Name = "The Artist"
+		albums = append(albums, album)
+	}
+
+	result, err := findMissingAlbums(context.Background(), index, &albumSlice{albums: albums}, &Config{Workers: 2}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Missing) != 2 || result.Missing[0].Name != "Album 2" || result.Missing[1].Name != "Album 3" {
+		t.Errorf("Expected albums 2 and 3 to be missing, got %v", result.Missing)
+	}
+	if len(offsets) != 1 {
+		t.Errorf("Expected no further library requests after indexing, got %d", len(offsets))
+	}
+}
+
+func TestLibraryIndexMatchesMBID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","albumList2":{"album":[
+			{"id":"1","name":"パラソムニア","artist":"ドリーム・シアター","songCount":8,"musicBrainzId":"B1F0D4A8-0F7A-4C7E-9D3F-6C4F0B8D2E11"},
+			{"id":"2","name":"Awake","artist":"Dream Theater","songCount":11}]}}}`))
+	}))
+	defer server.Close()
+
+	index, err := LoadLibraryIndex(context.Background(), NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parasomnia := Album{Name: "Parasomnia", MBID: "b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"}
+	parasomnia.Artist.Name = "Dream Theater"
+	awake := Album{Name: "Awake", MBID: "0a9c7a6e-0000-4000-8000-000000000000"}
+	awake.Artist.Name = "Dream Theater"
+
+	if match, _ := index.MatchAlbum(context.Background(), parasomnia); match.By != matchByMBID {
+		t.Errorf("Expected Parasomnia to match by MusicBrainz ID, got %+v", match)
+	}
+	if match, _ := index.MatchAlbum(context.Background(), awake); match.By != matchByName {
+		t.Errorf("Expected Awake to match by name, got %+v", match)
+	}
+}
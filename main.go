@@ -2,73 +2,30 @@ package main
 
 import (
 	"context"
-	"crypto/md5"
 	"crypto/tls"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"regexp"
-	"slices"
 	"strings"
 	"sync"
-	"text/tabwriter"
 	"time"
 )
 
 const (
 	lastFMAPIURL       = "http://ws.audioscrobbler.com/2.0/"
-	subsonicAPIPath    = "/rest/search3.view"
+	subsonicAPIPath    = "/rest/"
 	defaultTimeout     = 10 * time.Second
 	maxRetries         = 3
 	retryDelay         = 1 * time.Second
 	maxRecommendations = 5
 	lastFMAlbumLimit   = 500
+	lastFMTrackLimit   = 500
+	lastFMPageSize     = 500
+	defaultWorkers     = 4
 )
 
-// Album represents a music album from Last.fm API response
-type Album struct {
-	Name   string `json:"name"`
-	Artist struct {
-		Name string `json:"name"`
-	} `json:"artist"`
-	URL string `json:"url"`
-}
-
-// Topalbums represents the top albums section of Last.fm API response
-type Topalbums struct {
-	Album []Album `json:"album"`
-}
-
-// LastFMResponse represents the complete Last.fm API response structure
-type LastFMResponse struct {
-	Topalbums Topalbums `json:"topalbums"`
-}
-
-// SubsonicResponse represents the Subsonic API search response structure
-type SubsonicResponse struct {
-	SubsonicResponse struct {
-		SearchResult3 struct {
-			Album []struct {
-				Title  string `json:"name"`
-				Artist string `json:"artist"`
-			} `json:"album"`
-		} `json:"searchResult3"`
-	} `json:"subsonic-response"`
-}
-
-// Config holds all configuration values loaded from environment variables
-type Config struct {
-	LastFMAPIKey   string
-	LastFMUser     string
-	SubsonicServer string
-	SubsonicUser   string
-	SubsonicPass   string
-}
-
 // HTTPClient wraps http.Client with retry logic and configuration
 type HTTPClient struct {
 	client     *http.Client
@@ -76,10 +33,8 @@ type HTTPClient struct {
 	retryDelay time.Duration
 }
 
-// NewHTTPClient creates a new HTTPClient with default configuration and optional TLS verification skip
-func NewHTTPClient() *HTTPClient {
-	skipVerify := os.Getenv("INSECURE_SKIP_VERIFY") == "true"
-
+// newHTTPClient creates a new HTTPClient with default configuration and optional TLS verification skip
+func newHTTPClient(skipVerify bool) *HTTPClient {
 	return &HTTPClient{
 		client: &http.Client{
 			Timeout: defaultTimeout,
@@ -126,128 +81,6 @@ func (h *HTTPClient) DoWithRetry(ctx context.Context, req *http.Request) (*http.
 	return resp, fmt.Errorf("request failed with status %d after %d retries", resp.StatusCode, h.maxRetries)
 }
 
-// LastFMClient handles all Last.fm API operations
-type LastFMClient struct {
-	httpClient *HTTPClient
-	apiKey     string
-	baseURL    string
-}
-
-// NewLastFMClient creates a new Last.fm API client
-func NewLastFMClient(httpClient *HTTPClient, apiKey string) *LastFMClient {
-	return &LastFMClient{
-		httpClient: httpClient,
-		apiKey:     apiKey,
-		baseURL:    lastFMAPIURL,
-	}
-}
-
-// GetTopAlbums fetches the user's top albums from Last.fm for the past 12 months
-func (l *LastFMClient) GetTopAlbums(ctx context.Context, user string, limit int) ([]Album, error) {
-	url := fmt.Sprintf("%s?method=user.gettopalbums&user=%s&api_key=%s&format=json&period=12month&limit=%d",
-		l.baseURL, user, l.apiKey, limit)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := l.httpClient.DoWithRetry(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("Last.fm API request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var lastFMResp LastFMResponse
-	err = json.Unmarshal(body, &lastFMResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Last.fm response: %w", err)
-	}
-
-	return lastFMResp.Topalbums.Album, nil
-}
-
-// SubsonicClient handles all Subsonic API operations with authentication
-type SubsonicClient struct {
-	httpClient *HTTPClient
-	server     string
-	user       string
-	password   string
-}
-
-// NewSubsonicClient creates a new Subsonic API client
-func NewSubsonicClient(httpClient *HTTPClient, server, user, password string) *SubsonicClient {
-	return &SubsonicClient{
-		httpClient: httpClient,
-		server:     server,
-		user:       user,
-		password:   password,
-	}
-}
-
-// SearchAlbum searches for albums in the Subsonic library by name
-func (s *SubsonicClient) SearchAlbum(ctx context.Context, albumName string) ([]struct {
-	Title  string `json:"name"`
-	Artist string `json:"artist"`
-}, error) {
-	salt := time.Now().Format("20060102150405")
-	token := md5.Sum([]byte(s.password + salt))
-	tokenStr := hex.EncodeToString(token[:])
-
-	query := url.QueryEscape(cleanString(albumName))
-	requestURL := fmt.Sprintf("%s%s?u=%s&t=%s&s=%s&v=1.16.1&c=albumcheck&f=json&query=%s",
-		s.server, subsonicAPIPath,
-		url.QueryEscape(s.user),
-		tokenStr,
-		salt,
-		query)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := s.httpClient.DoWithRetry(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("Subsonic API request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read Subsonic response body: %w", err)
-	}
-
-	var subsonicResp SubsonicResponse
-	err = json.Unmarshal(body, &subsonicResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Subsonic response: %w", err)
-	}
-
-	return subsonicResp.SubsonicResponse.SearchResult3.Album, nil
-}
-
-// HasAlbum checks if a specific album exists in the Subsonic library
-func (s *SubsonicClient) HasAlbum(ctx context.Context, album Album) (bool, error) {
-	albums, err := s.SearchAlbum(ctx, album.Name)
-	if err != nil {
-		return false, err
-	}
-
-	for _, a := range albums {
-		if strings.EqualFold(cleanString(a.Title), cleanString(album.Name)) &&
-			strings.EqualFold(cleanString(a.Artist), cleanString(album.Artist.Name)) {
-			return true, nil
-		}
-	}
-	return false, nil
-}
-
 // ProgressIndicator provides visual feedback for long-running operations
 type ProgressIndicator struct {
 	mu       sync.Mutex
@@ -257,6 +90,7 @@ type ProgressIndicator struct {
 	total    int
 	showBar  bool
 	stopChan chan bool
+	out      io.Writer
 }
 
 // NewSpinner creates a new spinner progress indicator for indeterminate operations
@@ -265,6 +99,7 @@ func NewSpinner(message string) *ProgressIndicator {
 		message:  message,
 		showBar:  false,
 		stopChan: make(chan bool),
+		out:      os.Stderr,
 	}
 }
 
@@ -275,6 +110,7 @@ func NewProgressBar(message string, total int) *ProgressIndicator {
 		total:    total,
 		showBar:  true,
 		stopChan: make(chan bool),
+		out:      os.Stderr,
 	}
 }
 
@@ -303,13 +139,16 @@ func (p *ProgressIndicator) Start() {
 				}
 
 				if p.showBar {
-					percent := float64(p.current) / float64(p.total) * 100
+					percent := 0.0
+					if p.total > 0 {
+						percent = float64(p.current) / float64(p.total) * 100
+					}
 					barWidth := 30
 					filled := int(float64(barWidth) * percent / 100)
 					bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
-					fmt.Printf("\r%s [%s] %d/%d (%.1f%%)", p.message, bar, p.current, p.total, percent)
+					fmt.Fprintf(p.out, "\r%s [%s] %d/%d (%.1f%%)", p.message, bar, p.current, p.total, percent)
 				} else {
-					fmt.Printf("\r%s %c", p.message, spinChars[i%len(spinChars)])
+					fmt.Fprintf(p.out, "\r%s %c", p.message, spinChars[i%len(spinChars)])
 					i++
 				}
 				p.mu.Unlock()
@@ -325,6 +164,13 @@ func (p *ProgressIndicator) Update(current int) {
 	p.mu.Unlock()
 }
 
+// SetTotal changes the expected total for progress bars whose size is discovered while running
+func (p *ProgressIndicator) SetTotal(total int) {
+	p.mu.Lock()
+	p.total = total
+	p.mu.Unlock()
+}
+
 // Stop terminates the progress indicator and clears the display
 func (p *ProgressIndicator) Stop() {
 	p.mu.Lock()
@@ -332,142 +178,288 @@ func (p *ProgressIndicator) Stop() {
 	p.mu.Unlock()
 
 	close(p.stopChan)
-	fmt.Print("\r" + strings.Repeat(" ", 80) + "\r")
+	fmt.Fprint(p.out, "\r"+strings.Repeat(" ", 80)+"\r")
 }
 
 func main() {
-	cfg := loadConfig()
-
-	httpClient := NewHTTPClient()
-	lastFMClient := NewLastFMClient(httpClient, cfg.LastFMAPIKey)
-	subsonicClient := NewSubsonicClient(httpClient, cfg.SubsonicServer, cfg.SubsonicUser, cfg.SubsonicPass)
-
-	// Use separate context for Last.fm API call
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+	os.Exit(run(os.Args[1:]))
+}
 
-	spinner := NewSpinner("Fetching Last.fm top albums...")
-	spinner.Start()
-	albums, err := lastFMClient.GetTopAlbums(ctx, cfg.LastFMUser, lastFMAlbumLimit)
-	spinner.Stop()
+// ErrorStats tracks statistics about API errors during album checking
+type ErrorStats struct {
+	Total       int `json:"total"`
+	Successful  int `json:"successful"`
+	Failed      int `json:"failed"`
+	RateLimit   int `json:"rate_limit"`
+	ServerError int `json:"server_error"`
+	Network     int `json:"network"`
+	Other       int `json:"other"`
+}
 
-	if err != nil {
-		fmt.Printf("Error fetching Last.fm albums: %v\n", err)
-		os.Exit(1)
-	}
+// CheckResult summarises a run of Last.fm albums checked against the Subsonic library
+type CheckResult struct {
+	Albums  int // Last.fm albums examined, including ignored ones
+	Missing []*Album
+	Ignored int
+	Snoozed int        // albums held back by an active snooze in the ignore file
+	Matches MatchStats // how the albums found in the library were matched
+	Partial []*Album   // albums found in the library with fewer songs than tracks on Last.fm
+	Stats   ErrorStats
+}
 
-	// Use background context for album checking (no overall timeout)
-	recommendation := findMissingAlbums(context.Background(), subsonicClient, albums)
-	printRecommendation(recommendation)
+// findMissingAlbums identifies albums from Last.fm that checker does not find in the library.
+// It pulls batches from source until limit missing albums have been found, so no more Last.fm
+// pages are fetched than needed; a limit of 0 checks every album the source yields.
+func findMissingAlbums(ctx context.Context, checker AlbumChecker, source AlbumSource, cfg *Config, limit int) (*CheckResult, error) {
+	result := &CheckResult{Missing: make([]*Album, 0, limit)}
+	err := newAlbumScanner(checker, source, cfg).Scan(ctx, result, limit)
+	return result, err
 }
 
-// loadConfig loads configuration from environment variables and validates required fields
-func loadConfig() *Config {
-	cfg := &Config{
-		LastFMAPIKey:   os.Getenv("LASTFM_API_KEY"),
-		LastFMUser:     os.Getenv("LASTFM_USER"),
-		SubsonicServer: os.Getenv("SUBSONIC_SERVER"),
-		SubsonicUser:   os.Getenv("SUBSONIC_USER"),
-		SubsonicPass:   os.Getenv("SUBSONIC_PASSWORD"),
-	}
+// AlbumScanner checks albums from a source against the library, keeping its place in the
+// source between calls so that more missing albums can be requested later on
+type AlbumScanner struct {
+	checker    AlbumChecker
+	source     AlbumSource
+	cfg        *Config
+	ignoreList *IgnoreList
+	pending    []Album // rest of the current batch, not examined yet
+	exhausted  bool
+}
 
-	missing := []string{}
-	if cfg.LastFMAPIKey == "" {
-		missing = append(missing, "LASTFM_API_KEY")
-	}
-	if cfg.LastFMUser == "" {
-		missing = append(missing, "LASTFM_USER")
-	}
-	if cfg.SubsonicServer == "" {
-		missing = append(missing, "SUBSONIC_SERVER")
+// newAlbumScanner creates a scanner, loading the configured ignore file
+func newAlbumScanner(checker AlbumChecker, source AlbumSource, cfg *Config) *AlbumScanner {
+	return &AlbumScanner{
+		checker:    checker,
+		source:     source,
+		cfg:        cfg,
+		ignoreList: loadIgnoreList(cfg.IgnoreFile),
 	}
-	if cfg.SubsonicUser == "" {
-		missing = append(missing, "SUBSONIC_USER")
-	}
-	if cfg.SubsonicPass == "" {
-		missing = append(missing, "SUBSONIC_PASSWORD")
-	}
-	if len(missing) > 0 {
-		fmt.Printf("Missing: %v\n", missing)
-		os.Exit(1)
-	}
-
-	return cfg
 }
 
-// ErrorStats tracks statistics about API errors during album checking
-type ErrorStats struct {
-	Total       int
-	Successful  int
-	Failed      int
-	RateLimit   int
-	ServerError int
-	Network     int
-	Other       int
+// Exhausted reports whether the source has no more albums
+func (s *AlbumScanner) Exhausted() bool {
+	return s.exhausted && len(s.pending) == 0
 }
 
-// findMissingAlbums identifies albums from Last.fm that are not present in the Subsonic library
-func findMissingAlbums(ctx context.Context, subsonicClient *SubsonicClient, albums []Album) []*Album {
-	missing := make([]*Album, 0, maxRecommendations)
-	ignoredURLs := loadIgnoredURLs()
-	errorStats := &ErrorStats{}
-
-	progress := NewProgressBar("Checking albums in library...", len(albums))
+// Scan examines albums until limit more missing albums have been added to result, or the
+// source is exhausted; a limit of 0 examines every remaining album. Albums are looked up by
+// cfg.Workers concurrent workers, but their results are consumed in Last.fm order so the
+// missing albums, statistics and progress match a sequential run. Once ctx is cancelled
+// Scan returns ctx.Err().
+func (s *AlbumScanner) Scan(ctx context.Context, result *CheckResult, limit int) error {
+	cfg := s.cfg
+	errorStats := &result.Stats
+	found := 0
+
+	progress := NewProgressBar("Checking albums in library...", s.source.Total())
+	progress.Update(result.Albums)
 	progress.Start()
 	defer progress.Stop()
 
-	for i, album := range albums {
-		progress.Update(i + 1)
-
-		if isURLIgnored(album.URL, ignoredURLs) {
-			continue
+	for {
+		albums := s.pending
+		s.pending = nil
+		if len(albums) == 0 {
+			if s.exhausted {
+				return nil
+			}
+			var err error
+			albums, err = s.source.NextAlbums(ctx)
+			if err == io.EOF {
+				s.exhausted = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			progress.SetTotal(s.source.Total())
 		}
 
-		errorStats.Total++
-		exists, err := subsonicClient.HasAlbum(ctx, album)
-		if err != nil {
-			errorStats.Failed++
-			categorizeError(err, errorStats)
-			
-			// Show error details if verbose mode is enabled
-			if os.Getenv("VERBOSE") == "true" {
-				fmt.Printf("\nError checking album '%s - %s': %v\n", album.Artist.Name, album.Name, err)
+		lookups := make([]*albumLookup, len(albums))
+		for i, album := range albums {
+			lookups[i] = &albumLookup{album: album, done: make(chan struct{}), waited: make(chan struct{})}
+			if rule := s.ignoreList.Match(album); rule != nil {
+				lookups[i].ignored = true
+				lookups[i].snoozed = rule.Snoozed()
+				close(lookups[i].done)
+				if cfg.Verbose {
+					fmt.Fprintf(os.Stderr, "\nIgnoring '%s - %s' (line %d: %s)\n", album.Artist.Name, album.Name, rule.Line, rule)
+				}
 			}
-			continue
 		}
+		wait, stop := lookupAlbums(ctx, s.checker, lookups, cfg.Workers)
+
+		for i := range lookups {
+			lookup := wait(i)
+			if lookup == nil || ctx.Err() != nil {
+				// Lookups cut short by the cancellation are neither found nor failed
+				stop()
+				return ctx.Err()
+			}
+			album := lookup.album
+			result.Albums++
+			progress.Update(result.Albums)
+			
+			if lookup.ignored {
+				if lookup.snoozed {
+					result.Snoozed++
+				} else {
+					result.Ignored++
+				}
+				continue
+			}
 		
-		errorStats.Successful++
-		if !exists {
-			missing = append(missing, &album)
-			if len(missing) >= maxRecommendations {
-				break
+			errorStats.Total++
+			if lookup.err != nil {
+				errorStats.Failed++
+				categorizeError(lookup.err, errorStats)
+
+				// Show error details if verbose mode is enabled
+				if cfg.Verbose {
+					fmt.Fprintf(os.Stderr, "\nError checking album '%s - %s': %v\n", album.Artist.Name, album.Name, lookup.err)
+				}
+				continue
+			}
+
+			errorStats.Successful++
+			result.Matches.add(lookup.match)
+			partial := lookup.match.Partial()
+			if partial {
+				album.Songs, album.Tracks = lookup.match.Songs, lookup.match.Tracks
+				result.Partial = append(result.Partial, &album)
+			}
+			if !lookup.match.Owned || (partial && cfg.PartialAlbums == partialRecommend) {
+				result.Missing = append(result.Missing, &album)
+				found++
+				if limit > 0 && found >= limit {
+					stop()
+					s.pending = albums[i+1:]
+					return nil
+				}
 			}
 		}
+		stop()
+	}
+}
+
+// albumLookup is the library lookup of a single album; done is closed once
+// match and err are set, or right away for ignored albums, and waited once the
+// scan has taken its result
+type albumLookup struct {
+	album   Album
+	ignored bool
+	snoozed bool
+	match   AlbumMatch
+	err     error
+	done    chan struct{}
+	waited  chan struct{}
+}
+
+// lookupAlbums checks the albums of lookups against the library with up to
+// workers concurrent requests, dispatching them in order. The returned wait function
+// waits for the lookup at index i, or returns nil once ctx is cancelled, as lookups
+// that were never dispatched never finish. No lookup starts more than workers places
+// ahead of the ones waited for, so a scan that stops early wastes few requests. The
+// returned stop function cancels lookups that have not finished yet and waits for the
+// workers to exit; lookups abandoned this way are never marked done.
+func lookupAlbums(ctx context.Context, checker AlbumChecker, lookups []*albumLookup, workers int) (wait func(i int) *albumLookup, stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	window := max(workers, 1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		forEachConcurrently(ctx, len(lookups), workers, func(i int) {
+			lookup := lookups[i]
+			if lookup.ignored {
+				return
+			}
+			// Waiting for a given earlier lookup rather than for any free place keeps later
+			// lookups from taking the places of the ones the scan waits for
+			if i >= window {
+				select {
+				case <-lookups[i-window].waited:
+				case <-ctx.Done():
+					return
+				}
+			}
+			lookup.match, lookup.err = matchAlbum(ctx, checker, lookup.album)
+			close(lookup.done)
+		})
+	}()
+
+	wait = func(i int) *albumLookup {
+		select {
+		case <-lookups[i].done:
+		case <-ctx.Done():
+			return nil
+		}
+		close(lookups[i].waited)
+		return lookups[i]
+	}
+	return wait, func() {
+		cancel()
+		wg.Wait()
 	}
-	
-	// Report error statistics if there were any failures
-	if errorStats.Failed > 0 {
-		fmt.Printf("\nAPI Statistics: %d/%d requests successful", errorStats.Successful, errorStats.Total)
-		if errorStats.Failed > 0 {
-			fmt.Printf(" (%d failed)", errorStats.Failed)
 		}
-		fmt.Println()
+
+// forEachConcurrently calls fn for every index from 0 to n-1 with up to workers concurrent
+// calls, handing the indexes out in order. Once ctx is cancelled no further calls start;
+// forEachConcurrently returns when the calls that did start have returned.
+func forEachConcurrently(ctx context.Context, n, workers int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() == nil {
+					fn(i)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range n {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// albumKey builds a case-insensitive lookup key from normalized artist and album (or track) names
+func albumKey(artist, name string) string {
+	return strings.ToLower(cleanString(artist)) + "\x00" + strings.ToLower(cleanString(name))
+}
+
+// printErrorStats reports error statistics if there were any failures
+func printErrorStats(w io.Writer, errorStats ErrorStats) {
+	if errorStats.Failed == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nAPI Statistics: %d/%d requests successful (%d failed)\n", errorStats.Successful, errorStats.Total, errorStats.Failed)
 		
 		if errorStats.RateLimit > 0 {
-			fmt.Printf("⚠️  Rate limiting detected (%d requests) - server may be limiting API calls\n", errorStats.RateLimit)
+		fmt.Fprintf(w, "⚠️  Rate limiting detected (%d requests) - server may be limiting API calls\n", errorStats.RateLimit)
 		}
 		if errorStats.ServerError > 0 {
-			fmt.Printf("⚠️  Server errors detected (%d requests) - Subsonic server may be overloaded\n", errorStats.ServerError)
+		fmt.Fprintf(w, "⚠️  Server errors detected (%d requests) - Subsonic server may be overloaded\n", errorStats.ServerError)
 		}
 		if errorStats.Network > 0 {
-			fmt.Printf("⚠️  Network issues detected (%d requests) - connection problems to server\n", errorStats.Network)
+		fmt.Fprintf(w, "⚠️  Network issues detected (%d requests) - connection problems to server\n", errorStats.Network)
 		}
 		if errorStats.Other > 0 {
-			fmt.Printf("⚠️  Other errors detected (%d requests) - run with VERBOSE=true for details\n", errorStats.Other)
+		fmt.Fprintf(w, "⚠️  Other errors detected (%d requests) - run with VERBOSE=true for details\n", errorStats.Other)
 		}
-	}
-	
-	return missing
 }
 
 // categorizeError analyzes the error to determine its likely cause
@@ -527,56 +519,3 @@ func cleanString(s string) string {
 
 	return cleaned
 }
-
-// printRecommendation displays the list of recommended albums in a formatted table
-func printRecommendation(albums []*Album) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	defer w.Flush()
-
-	if len(albums) == 0 {
-		fmt.Println("All top albums exist in your Subsonic library!")
-		return
-	}
-
-	fmt.Fprintln(w, "RECOMMENDED ALBUMS\t")
-	fmt.Fprintln(w, strings.Repeat("=", 80))
-	for i, album := range albums {
-		fmt.Fprintf(w, "%d. %s - %s\n", i+1, album.Artist.Name, album.Name)
-		fmt.Fprintf(w, "   Last.fm URL:\t%s\n", album.URL)
-		fmt.Fprintln(w, strings.Repeat("-", 80))
-	}
-}
-
-// loadIgnoredURLs reads a list of Last.fm URLs to ignore from the file specified
-// in the IGNORE_FILE environment variable
-func loadIgnoredURLs() []string {
-	filePath := os.Getenv("IGNORE_FILE")
-	if filePath == "" {
-		return []string{} // No ignore file specified
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		// Handle the error, e.g., log it or print a warning
-		fmt.Printf("Warning: Could not open ignore file: %v\n", err)
-		return []string{} // Return an empty slice, effectively ignoring the error
-	}
-	defer file.Close()
-
-	var ignoredURLs []string
-	content, _ := io.ReadAll(file)
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line) // Remove leading/trailing whitespace
-		if line != "" {                // Ignore empty lines
-			ignoredURLs = append(ignoredURLs, line)
-		}
-	}
-
-	return ignoredURLs
-}
-
-// isURLIgnored checks if a URL is in the ignore list
-func isURLIgnored(url string, ignoredURLs []string) bool {
-	return slices.Contains(ignoredURLs, url)
-}
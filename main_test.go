@@ -4,21 +4,39 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// testAlbum returns a Last.fm album by artist
+func testAlbum(artist, name string) Album {
+	album := Album{Name: name}
+	album.Artist.Name = artist
+	return album
+}
+
+// testTrack returns a Last.fm top track by artist, played plays times
+func testTrack(artist, name string, plays int) Track {
+	track := Track{Name: name, PlayCount: flexInt(plays)}
+	track.Artist.Name = artist
+	return track
+}
+
 func TestNewHTTPClient(t *testing.T) {
-	client := NewHTTPClient()
+	client := newHTTPClient(false)
 	
 	if client == nil {
-		t.Fatal("NewHTTPClient returned nil")
+		t.Fatal("newHTTPClient returned nil")
 	}
 	
 	if client.maxRetries != maxRetries {
@@ -35,10 +53,15 @@ func TestNewHTTPClient(t *testing.T) {
 }
 
 func TestNewHTTPClientWithInsecureSkipVerify(t *testing.T) {
+	isolateConfig(t)
 	os.Setenv("INSECURE_SKIP_VERIFY", "true")
 	defer os.Unsetenv("INSECURE_SKIP_VERIFY")
 	
-	client := NewHTTPClient()
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newHTTPClient(cfg.InsecureSkipVerify)
 	
 	transport, ok := client.client.Transport.(*http.Transport)
 	if !ok {
@@ -57,7 +80,7 @@ func TestHTTPClientDoWithRetrySuccess(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	client := NewHTTPClient()
+	client := newHTTPClient(false)
 	ctx := context.Background()
 	
 	req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
@@ -136,7 +159,7 @@ func TestHTTPClientDoWithRetryContextCancellation(t *testing.T) {
 }
 
 func TestNewLastFMClient(t *testing.T) {
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	apiKey := "test-api-key"
 	
 	client := NewLastFMClient(httpClient, apiKey)
@@ -192,6 +215,9 @@ func TestLastFMClientGetTopAlbums(t *testing.T) {
 		if r.URL.Query().Get("api_key") != "test-key" {
 			t.Error("Expected api_key=test-key in query")
 		}
+		if r.URL.Query().Get("period") != "12month" {
+			t.Error("Expected period=12month in query")
+		}
 		
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -199,7 +225,7 @@ func TestLastFMClientGetTopAlbums(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	client := &LastFMClient{
 		httpClient: httpClient,
 		apiKey:     "test-key",
@@ -207,7 +233,7 @@ func TestLastFMClientGetTopAlbums(t *testing.T) {
 	}
 	
 	ctx := context.Background()
-	albums, err := client.GetTopAlbums(ctx, "testuser", 10)
+	albums, err := client.GetTopAlbums(ctx, "testuser", "12month", 10)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -232,7 +258,7 @@ func TestLastFMClientGetTopAlbumsInvalidJSON(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	client := &LastFMClient{
 		httpClient: httpClient,
 		apiKey:     "test-key",
@@ -240,7 +266,7 @@ func TestLastFMClientGetTopAlbumsInvalidJSON(t *testing.T) {
 	}
 	
 	ctx := context.Background()
-	_, err := client.GetTopAlbums(ctx, "testuser", 10)
+	_, err := client.GetTopAlbums(ctx, "testuser", "12month", 10)
 	if err == nil {
 		t.Error("Expected error for invalid JSON")
 	}
@@ -250,8 +276,244 @@ func TestLastFMClientGetTopAlbumsInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestLastFMClientGetTopAlbumsPlayCountAndRank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"topalbums":{"album":[
+			{"name":"A","artist":{"name":"X"},"playcount":"312","@attr":{"rank":"1"}},
+			{"name":"B","artist":{"name":"Y"},"playcount":42}
+		]}}`))
+	}))
+	defer server.Close()
+
+	client := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: server.URL + "/"}
+
+	albums, err := client.GetTopAlbums(context.Background(), "testuser", "12month", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if albums[0].PlayCount != 312 || albums[0].Attr.Rank != 1 {
+		t.Errorf("Expected playcount 312 and rank 1, got %d and %d", albums[0].PlayCount, albums[0].Attr.Rank)
+	}
+
+	// Missing ranks are filled in from the album's position
+	if albums[1].PlayCount != 42 || albums[1].Attr.Rank != 2 {
+		t.Errorf("Expected playcount 42 and rank 2, got %d and %d", albums[1].PlayCount, albums[1].Attr.Rank)
+	}
+}
+
+func TestLastFMClientGetTopAlbumsMBIDAndImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"topalbums":{"album":[{"name":"A","artist":{"name":"X"},"mbid":"abc-123","image":[
+			{"#text":"https://img.example.com/small.png","size":"small"},
+			{"#text":"https://img.example.com/large.png","size":"large"},
+			{"#text":"","size":"extralarge"}
+		]}]}}`))
+	}))
+	defer server.Close()
+
+	client := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: server.URL + "/"}
+
+	albums, err := client.GetTopAlbums(context.Background(), "testuser", "12month", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if albums[0].MBID != "abc-123" {
+		t.Errorf("Expected mbid 'abc-123', got '%s'", albums[0].MBID)
+	}
+	if len(albums[0].Image) != 3 {
+		t.Fatalf("Expected 3 images, got %d", len(albums[0].Image))
+	}
+	if albums[0].ImageURL() != "https://img.example.com/large.png" {
+		t.Errorf("Expected largest non-empty image, got '%s'", albums[0].ImageURL())
+	}
+	if (Album{}).ImageURL() != "" {
+		t.Error("Expected empty image URL for album without images")
+	}
+}
+
+func TestLastFMClientGetTopAlbumsInvalidPeriod(t *testing.T) {
+	client := NewLastFMClient(newHTTPClient(false), "test-key")
+
+	_, err := client.GetTopAlbums(context.Background(), "testuser", "fortnight", 10)
+	if err == nil {
+		t.Fatal("Expected error for unsupported period")
+	}
+
+	if !strings.Contains(err.Error(), "unsupported Last.fm period") {
+		t.Errorf("Expected unsupported period error, got: %v", err)
+	}
+}
+
+// newPagedLastFMServer serves totalAlbums top albums split into pages of the requested size
+// and counts the pages that were requested
+func newPagedLastFMServer(t *testing.T, totalAlbums int, requests *int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		totalPages := (totalAlbums + limit - 1) / limit
+
+		var albums []map[string]any
+		for i := (page - 1) * limit; i < page*limit && i < totalAlbums; i++ {
+			albums = append(albums, map[string]any{
+				"name":   fmt.Sprintf("Album %d", i+1),
+				"artist": map[string]string{"name": "Artist"},
+				"url":    fmt.Sprintf("https://www.last.fm/music/Artist/Album+%d", i+1),
+			})
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"topalbums": map[string]any{
+				"album": albums,
+				"@attr": map[string]string{
+					"page":       strconv.Itoa(page),
+					"perPage":    strconv.Itoa(limit),
+					"totalPages": strconv.Itoa(totalPages),
+					"total":      strconv.Itoa(totalAlbums),
+				},
+			},
+		})
+	}))
+}
+
+func TestTopAlbumPagerWalksPages(t *testing.T) {
+	requests := 0
+	server := newPagedLastFMServer(t, 1200, &requests)
+	defer server.Close()
+
+	client := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: server.URL + "/"}
+
+	albums, err := client.GetTopAlbums(context.Background(), "testuser", "12month", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(albums) != 1200 {
+		t.Errorf("Expected 1200 albums, got %d", len(albums))
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 page requests, got %d", requests)
+	}
+	if albums[1199].Name != "Album 1200" {
+		t.Errorf("Expected last album 'Album 1200', got '%s'", albums[1199].Name)
+	}
+}
+
+func TestTopAlbumPagerMaxAlbums(t *testing.T) {
+	requests := 0
+	server := newPagedLastFMServer(t, 1200, &requests)
+	defer server.Close()
+
+	client := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: server.URL + "/"}
+	pager := client.NewTopAlbumPager("testuser", "12month", 700)
+
+	var albums []Album
+	for {
+		page, err := pager.NextAlbums(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		albums = append(albums, page...)
+	}
+
+	if len(albums) != 700 {
+		t.Errorf("Expected 700 albums, got %d", len(albums))
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 page requests, got %d", requests)
+	}
+	if pager.Total() != 700 {
+		t.Errorf("Expected total capped at 700, got %d", pager.Total())
+	}
+}
+
+func TestLastFMClientGetTopTracksWalksPages(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		pages = append(pages, query.Get("page")+"/"+query.Get("limit"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page, _ := strconv.Atoi(query.Get("page"))
+
+		var tracks []map[string]any
+		for i := (page - 1) * limit; i < page*limit && i < 1200; i++ {
+			tracks = append(tracks, map[string]any{"name": fmt.Sprintf("Track %d", i+1), "artist": map[string]string{"name": "Artist"}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"toptracks": map[string]any{
+				"track": tracks,
+				"@attr": map[string]string{"page": strconv.Itoa(page), "totalPages": strconv.Itoa((1200 + limit - 1) / limit), "total": "1200"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: server.URL + "/"}
+	tracks, err := client.GetTopTracks(context.Background(), "testuser", "12month", 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracks) != 700 {
+		t.Fatalf("Expected 700 tracks, got %d", len(tracks))
+	}
+	if want := []string{"1/500", "2/500"}; !slices.Equal(pages, want) {
+		t.Errorf("Expected pages %v, got %v", want, pages)
+	}
+	if last := tracks[699]; last.Name != "Track 700" || last.Attr.Rank != 700 {
+		t.Errorf("Expected 'Track 700' ranked 700 last, got %q ranked %d", last.Name, last.Attr.Rank)
+	}
+
+	if _, err := client.GetTopTracks(context.Background(), "testuser", "2week", 0); err == nil || !strings.Contains(err.Error(), "unsupported Last.fm period") {
+		t.Errorf("Expected unsupported period error, got: %v", err)
+	}
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	var calls []int
+	running, most := 0, 0
+	forEachConcurrently(context.Background(), 20, 3, func(i int) {
+		mu.Lock()
+		calls = append(calls, i)
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	slices.Sort(calls)
+	if len(calls) != 20 || calls[0] != 0 || calls[19] != 19 || slices.Compact(calls)[19] != 19 {
+		t.Errorf("Expected every index to be called once, got %v", calls)
+	}
+	if most > 3 {
+		t.Errorf("Expected at most 3 concurrent calls, got %d", most)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	called := 0
+	forEachConcurrently(ctx, 20, 1, func(i int) {
+		called++
+		if i == 4 {
+			cancel()
+		}
+	})
+	if called != 5 {
+		t.Errorf("Expected the cancellation to stop further calls, got %d calls", called)
+	}
+}
+
 func TestNewSubsonicClient(t *testing.T) {
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	server := "https://test.example.com"
 	user := "testuser"
 	password := "testpass"
@@ -283,22 +545,13 @@ func TestSubsonicClientSearchAlbum(t *testing.T) {
 	mockResponse := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{
+				Album: []SubsonicAlbum{
 					{Title: "Test Album", Artist: "Test Artist"},
 				},
 			},
@@ -326,7 +579,7 @@ func TestSubsonicClientSearchAlbum(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	client := &SubsonicClient{
 		httpClient: httpClient,
 		server:     server.URL,
@@ -357,22 +610,13 @@ func TestSubsonicClientHasAlbumTrue(t *testing.T) {
 	mockResponse := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{
+				Album: []SubsonicAlbum{
 					{Title: "Test Album", Artist: "Test Artist"},
 				},
 			},
@@ -388,7 +632,7 @@ func TestSubsonicClientHasAlbumTrue(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	client := &SubsonicClient{
 		httpClient: httpClient,
 		server:     server.URL,
@@ -418,22 +662,13 @@ func TestSubsonicClientHasAlbumFalse(t *testing.T) {
 	mockResponse := SubsonicResponse{
 		SubsonicResponse: struct {
 			SearchResult3 struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			} `json:"searchResult3"`
 		}{
 			SearchResult3: struct {
-				Album []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				} `json:"album"`
+				Album []SubsonicAlbum `json:"album"`
 			}{
-				Album: []struct {
-					Title  string `json:"name"`
-					Artist string `json:"artist"`
-				}{
+				Album: []SubsonicAlbum{
 					{Title: "Different Album", Artist: "Different Artist"},
 				},
 			},
@@ -449,7 +684,7 @@ func TestSubsonicClientHasAlbumFalse(t *testing.T) {
 	}))
 	defer server.Close()
 	
-	httpClient := NewHTTPClient()
+	httpClient := newHTTPClient(false)
 	client := &SubsonicClient{
 		httpClient: httpClient,
 		server:     server.URL,
@@ -475,95 +710,114 @@ func TestSubsonicClientHasAlbumFalse(t *testing.T) {
 	}
 }
 
-func TestCleanString(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"Test Album", "Test Album"},
-		{"Test Album (Deluxe Edition)", "Test Album"},
-		{"Test Album (2021 Remaster)", "Test Album"},
-		{"Test Album [Bonus Tracks]", "Test Album Bonus Tracks"},
-		{"Test  Album   ", "Test Album"},
-		{"Test-Album&Special", "TestAlbumSpecial"},
-		{"Test@Album#123", "TestAlbum123"},
-		{"   Test Album   ", "Test Album"},
-		{"", ""},
-		{"Test Album (Live) (Bonus)", "Test Album Live"},
-	}
-	
-	for _, test := range tests {
-		result := cleanString(test.input)
-		if result != test.expected {
-			t.Errorf("cleanString(%q) = %q, expected %q", test.input, result, test.expected)
+// newAmbiguousSubsonicServer serves a library with more "Greatest Hits" albums than a search
+// returns, none of them by Queen, whose own albums are only listed by getArtist
+func newAmbiguousSubsonicServer(t *testing.T, requests *[]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		endpoint := strings.TrimPrefix(r.URL.Path, subsonicAPIPath)
+		*requests = append(*requests, endpoint+" "+query.Get("query")+query.Get("id")+" "+query.Get("albumOffset"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case endpoint == "getArtist.view":
+			w.Write([]byte(`{"subsonic-response":{"status":"ok","artist":{"id":"ar1","name":"Queen","album":[{"id":"q1","name":"Greatest Hits"}]}}}`))
+		case query.Get("artistCount") != "0":
+			w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{"artist":[{"id":"ar1","name":"Queen"},{"id":"ar2","name":"Queens of the Stone Age"}]}}}`))
+		case query.Get("query") == "Greatest Hits":
+			var albums []SubsonicAlbum
+			for i := range searchPageSize {
+				albums = append(albums, SubsonicAlbum{Title: "Greatest Hits", Artist: fmt.Sprintf("Artist %s-%d", query.Get("albumOffset"), i)})
+			}
+			var resp SubsonicResponse
+			resp.SubsonicResponse.SearchResult3.Album = albums
+			json.NewEncoder(w).Encode(resp)
+		default:
+			w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{}}}`))
 		}
-	}
+	}))
 }
 
-func TestLoadIgnoredURLsNoFile(t *testing.T) {
-	os.Unsetenv("IGNORE_FILE")
-	
-	urls := loadIgnoredURLs()
-	if len(urls) != 0 {
-		t.Errorf("Expected empty slice, got %v", urls)
+func TestSubsonicClientSearchAlbumPaging(t *testing.T) {
+	var requests []string
+	server := newAmbiguousSubsonicServer(t, &requests)
+	defer server.Close()
+
+	client := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+	albums, err := client.SearchAlbum(context.Background(), "Greatest Hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(albums) != searchAlbumLimit {
+		t.Errorf("Expected %d albums, got %d", searchAlbumLimit, len(albums))
+	}
+	expected := "search3.view Greatest Hits 0|search3.view Greatest Hits 50|search3.view Greatest Hits 100"
+	if got := strings.Join(requests, "|"); got != expected {
+		t.Errorf("Expected requests\n%s\ngot\n%s", expected, got)
 	}
 }
 
-func TestLoadIgnoredURLsWithFile(t *testing.T) {
-	content := "https://www.last.fm/music/Artist1/Album1\nhttps://www.last.fm/music/Artist2/Album2\n\n\nhttps://www.last.fm/music/Artist3/Album3"
-	
-	tmpFile, err := os.CreateTemp("", "ignore_test")
+func TestSubsonicClientMatchAlbumFallsBackToArtist(t *testing.T) {
+	var requests []string
+	server := newAmbiguousSubsonicServer(t, &requests)
+	defer server.Close()
+
+	client := NewSubsonicClient(newHTTPClient(false), server.URL, "testuser", "testpass")
+	client.matcher = &Matcher{Threshold: 1}
+
+	album := Album{Name: "Greatest Hits"}
+	album.Artist.Name = "Queen"
+	match, err := client.MatchAlbum(context.Background(), album)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(tmpFile.Name())
-	
-	if _, err := tmpFile.WriteString(content); err != nil {
-		t.Fatal(err)
+	if !match.Owned {
+		t.Error("Expected the album to be found through getArtist")
 	}
-	tmpFile.Close()
-	
-	os.Setenv("IGNORE_FILE", tmpFile.Name())
-	defer os.Unsetenv("IGNORE_FILE")
-	
-	urls := loadIgnoredURLs()
+
 	expected := []string{
-		"https://www.last.fm/music/Artist1/Album1",
-		"https://www.last.fm/music/Artist2/Album2",
-		"https://www.last.fm/music/Artist3/Album3",
+		"search3.view Greatest Hits 0", "search3.view Greatest Hits 50", "search3.view Greatest Hits 100",
+		"search3.view Queen Greatest Hits 0",
+		"search3.view Queen ",
+		"getArtist.view ar1 ",
 	}
-	
-	if len(urls) != len(expected) {
-		t.Errorf("Expected %d URLs, got %d", len(expected), len(urls))
+	if got := strings.Join(requests, "|"); got != strings.Join(expected, "|") {
+		t.Errorf("Expected requests\n%v\ngot\n%v", expected, requests)
 	}
-	
-	for i, url := range urls {
-		if url != expected[i] {
-			t.Errorf("Expected URL %s, got %s", expected[i], url)
-		}
+
+	requests = nil
+	album.Name = "A Night at the Opera"
+	if match, err := client.MatchAlbum(context.Background(), album); err != nil || match.Owned {
+		t.Errorf("Expected A Night at the Opera to be missing, got %+v (%v)", match, err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("Expected an unambiguous search to be the only request, got %v", requests)
 	}
 }
 
-func TestIsURLIgnored(t *testing.T) {
-	ignoredURLs := []string{
-		"https://www.last.fm/music/Artist1/Album1",
-		"https://www.last.fm/music/Artist2/Album2",
-	}
-	
+func TestCleanString(t *testing.T) {
 	tests := []struct {
-		url      string
-		expected bool
+		input    string
+		expected string
 	}{
-		{"https://www.last.fm/music/Artist1/Album1", true},
-		{"https://www.last.fm/music/Artist2/Album2", true},
-		{"https://www.last.fm/music/Artist3/Album3", false},
-		{"", false},
+		{"Test Album", "Test Album"},
+		{"Test Album (Deluxe Edition)", "Test Album"},
+		{"Test Album (2021 Remaster)", "Test Album"},
+		{"Test Album [Bonus Tracks]", "Test Album Bonus Tracks"},
+		{"Test  Album   ", "Test Album"},
+		{"Test-Album&Special", "TestAlbumSpecial"},
+		{"Test@Album#123", "TestAlbum123"},
+		{"   Test Album   ", "Test Album"},
+		{"", ""},
+		{"Test Album (Live) (Bonus)", "Test Album Live"},
 	}
 	
 	for _, test := range tests {
-		result := isURLIgnored(test.url, ignoredURLs)
+		result := cleanString(test.input)
 		if result != test.expected {
-			t.Errorf("isURLIgnored(%q) = %v, expected %v", test.url, result, test.expected)
+			t.Errorf("cleanString(%q) = %q, expected %q", test.input, result, test.expected)
 		}
 	}
 }
@@ -626,35 +880,25 @@ func TestProgressIndicatorUpdate(t *testing.T) {
 }
 
 func TestLoadConfigMissingValues(t *testing.T) {
-	oldArgs := os.Args
-	defer func() { os.Args = oldArgs }()
-	
-	originalEnv := map[string]string{
-		"LASTFM_API_KEY":     os.Getenv("LASTFM_API_KEY"),
-		"LASTFM_USER":        os.Getenv("LASTFM_USER"),
-		"SUBSONIC_SERVER":    os.Getenv("SUBSONIC_SERVER"),
-		"SUBSONIC_USER":      os.Getenv("SUBSONIC_USER"),
-		"SUBSONIC_PASSWORD":  os.Getenv("SUBSONIC_PASSWORD"),
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(configPathEnv, "")
+	for _, key := range []string{"LASTFM_API_KEY", "LASTFM_USER", "SUBSONIC_SERVER", "SUBSONIC_USER", "SUBSONIC_PASSWORD"} {
+		t.Setenv(key, "")
 	}
 	
-	defer func() {
-		for key, value := range originalEnv {
-			if value == "" {
-				os.Unsetenv(key)
-			} else {
-				os.Setenv(key, value)
-			}
-		}
-	}()
-	
-	for key := range originalEnv {
-		os.Unsetenv(key)
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
 	}
 	
-	if os.Getenv("SKIP_EXIT_TEST") == "" {
-		_, err := os.Open("/dev/null")
+	err = errors.Join(cfg.requireLastFM(), cfg.requireSubsonic())
 		if err == nil {
-			t.Skip("Skipping exit test to avoid process termination")
+		t.Fatal("Expected error for missing settings")
+	}
+
+	for _, key := range []string{"LASTFM_API_KEY", "LASTFM_USER", "SUBSONIC_SERVER", "SUBSONIC_USER", "SUBSONIC_PASSWORD"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected error to mention %s, got: %v", key, err)
 		}
 	}
 }
@@ -683,8 +927,13 @@ func TestLoadConfigValidValues(t *testing.T) {
 	os.Setenv("SUBSONIC_SERVER", "https://test.example.com")
 	os.Setenv("SUBSONIC_USER", "test-subsonic-user")
 	os.Setenv("SUBSONIC_PASSWORD", "test-password")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(configPathEnv, "")
 	
-	cfg := loadConfig()
+	cfg, err := loadConfig(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
 	
 	if cfg.LastFMAPIKey != "test-api-key" {
 		t.Errorf("Expected LastFMAPIKey 'test-api-key', got '%s'", cfg.LastFMAPIKey)
@@ -709,21 +958,13 @@ func TestLoadConfigValidValues(t *testing.T) {
 
 func TestPrintRecommendationNoAlbums(t *testing.T) {
 	var buf bytes.Buffer
-	oldStdout := os.Stdout
-	
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-	
-	go func() {
-		defer w.Close()
-		printRecommendation([]*Album{})
-	}()
-	
-	io.Copy(&buf, r)
-	os.Stdout = oldStdout
+	report := newReport(&Config{LastFMPeriod: "12month"}, &CheckResult{})
+	if err := printRecommendation(&buf, report); err != nil {
+		t.Fatal(err)
+	}
 	
 	output := buf.String()
-	if !strings.Contains(output, "All top albums exist in your Subsonic library!") {
+	if !strings.Contains(output, "All top albums (last 12 months) exist in your Subsonic library!") {
 		t.Errorf("Expected message about all albums existing, got: %s", output)
 	}
 }
@@ -747,23 +988,15 @@ func TestPrintRecommendationWithAlbums(t *testing.T) {
 	}
 	
 	var buf bytes.Buffer
-	oldStdout := os.Stdout
-	
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-	
-	go func() {
-		defer w.Close()
-		printRecommendation(albums)
-	}()
-	
-	io.Copy(&buf, r)
-	os.Stdout = oldStdout
+	report := newReport(&Config{LastFMPeriod: "12month"}, &CheckResult{Missing: albums})
+	if err := printRecommendation(&buf, report); err != nil {
+		t.Fatal(err)
+	}
 	
 	output := buf.String()
 	
-	if !strings.Contains(output, "RECOMMENDED ALBUMS") {
-		t.Error("Expected 'RECOMMENDED ALBUMS' in output")
+	if !strings.Contains(output, "RECOMMENDED ALBUMS (last 12 months)") {
+		t.Error("Expected 'RECOMMENDED ALBUMS (last 12 months)' in output")
 	}
 	
 	if !strings.Contains(output, "Test Artist 1 - Test Album 1") {
@@ -856,4 +1089,4 @@ func TestCategorizeError(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
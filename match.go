@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// defaultMatchThreshold requires equal names; fuzzy matching is opt-in
+	defaultMatchThreshold = 1
+	// tokenMatchThreshold is the similarity above which a word of one name counts as present
+	// in the other, so that typos do not count as extra words
+	tokenMatchThreshold = 0.75
+)
+
+// numberToken matches tokens that tell apart otherwise equal titles, such as volume numbers,
+// years and roman numerals
+var numberToken = regexp.MustCompile(`^(\d+|[ivx]*(ii|iv|vi|ix|xi|xv|xx)[ivx]*)$`)
+
+// tokenDigits matches the digits of words such as "lp2" or "24bit"
+var tokenDigits = regexp.MustCompile(`\d+`)
+
+// spelledNumbers maps spelled-out numbers to digits, so that "Volume Two" compares as "Volume 2"
+var spelledNumbers = map[string]string{
+	"one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7",
+	"eight": "8", "nine": "9", "ten": "10", "eleven": "11", "twelve": "12", "thirteen": "13",
+	"fourteen": "14", "fifteen": "15", "sixteen": "16", "seventeen": "17", "eighteen": "18",
+	"nineteen": "19", "twenty": "20",
+}
+
+// Matcher decides whether a library album is the Last.fm album being looked for. Names are
+// compared in their normalized form; with a threshold below 1, names that are merely similar
+// enough also match, which catches typos and leftover edition suffixes.
+type Matcher struct {
+	Threshold  float64       // minimum similarity of both artist and title, 1 requires equal names
+	Normalizer *Normalizer   // nil only applies cleanString
+	Aliases    []ArtistAlias // other names of Last.fm artists in the library
+	Log        io.Writer     // receives the closest library album of every inexact lookup when set
+}
+
+// matchCandidate is a library album considered for a Last.fm album
+type matchCandidate struct {
+	Artist string
+	Title  string
+	MBID   string // MusicBrainz ID, if known
+	ID     string // library album ID
+	Songs  int    // songs of the album in the library
+}
+
+// String formats the candidate as "Artist - Album"
+func (c matchCandidate) String() string {
+	return c.Artist + " - " + c.Title
+}
+
+// threshold returns the effective threshold; a nil matcher requires equal names
+func (m *Matcher) threshold() float64 {
+	if m == nil || m.Threshold <= 0 {
+		return 1
+	}
+	return m.Threshold
+}
+
+// normalizer returns the normalizer of the matcher, nil for a nil matcher
+func (m *Matcher) normalizer() *Normalizer {
+	if m == nil {
+		return nil
+	}
+	return m.Normalizer
+}
+
+// Fingerprint identifies the settings that decide what the matcher matches: the threshold,
+// the edition rules, the normalization steps and the aliases. Lookups cached under another
+// fingerprint may have been decided differently.
+func (m *Matcher) Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "threshold %g\n", m.threshold())
+	if n := m.normalizer(); n != nil {
+		for _, rule := range n.EditionRules {
+			fmt.Fprintf(h, "rule %s\n", rule)
+		}
+		fmt.Fprintf(h, "fold %t and %t article %t\n", n.FoldDiacritics, n.FoldAnd, n.DropArticle)
+	}
+	if m != nil {
+		for _, alias := range m.Aliases {
+			fmt.Fprintf(h, "alias %q %q\n", alias.Artist, alias.Library)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// Match looks for the album among candidates. An album and a candidate with the same
+// MusicBrainz ID always match; otherwise the names decide, as Last.fm and the library
+// often refer to different releases of the same album.
+func (m *Matcher) Match(album Album, candidates []matchCandidate) AlbumMatch {
+	i, by := m.choose(album, candidates)
+	if i < 0 {
+		return AlbumMatch{}
+	}
+	return AlbumMatch{Owned: true, By: by, ID: candidates[i].ID, Songs: candidates[i].Songs}
+}
+
+// choose returns the index of the candidate Match takes to be the album, -1 for none, and
+// how it matched
+func (m *Matcher) choose(album Album, candidates []matchCandidate) (int, string) {
+	if album.MBID != "" {
+		for i, c := range candidates {
+			if strings.EqualFold(c.MBID, album.MBID) {
+				return i, matchByMBID
+			}
+		}
+	}
+	if c, _, ok := m.Best(album, candidates); ok {
+		return slices.Index(candidates, c), matchByName
+	}
+	return -1, ""
+}
+
+// Best returns the candidate most similar to the album together with its score, and whether
+// the score reaches the threshold. The score is the lower of the artist and title similarity.
+func (m *Matcher) Best(album Album, candidates []matchCandidate) (best matchCandidate, score float64, ok bool) {
+	n := m.normalizer()
+	artists, title := m.artistNames(album.Artist.Name), n.Title(album.Name)
+	threshold := m.threshold()
+
+	for _, c := range candidates {
+		cArtist, cTitle := n.Artist(c.Artist), n.Title(c.Title)
+		if slices.Contains(artists, cArtist) && cTitle == title {
+			return c, 1, true
+		}
+		if threshold == 1 {
+			continue
+		}
+		if s := min(artistSimilarity(artists, cArtist), similarity(title, cTitle)); s > score {
+			best, score = c, s
+		}
+	}
+
+	ok = score >= threshold && score > 0
+	if m != nil && m.Log != nil && score > 0 {
+		if ok {
+			fmt.Fprintf(m.Log, "\nMatched '%s - %s' to library album '%s' (score %.2f)\n", album.Artist.Name, album.Name, best, score)
+		} else {
+			fmt.Fprintf(m.Log, "\nClosest library album to '%s - %s' is '%s' (score %.2f, threshold %.2f)\n",
+				album.Artist.Name, album.Name, best, score, threshold)
+		}
+	}
+	return best, score, ok
+}
+
+// similarity scores two normalized names between 0 and 1. Word order is ignored, and names
+// whose numbers differ never count as similar, so "Vol. 1" does not match "Vol. 2". Words
+// of either name without a similar word in the other lower the score by their share of the
+// letters, since Jaro-Winkler alone rates a name followed by another word, as "Rumours Live"
+// after "Rumours", almost as high as the name itself.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	aTokens, bTokens := strings.Fields(a), strings.Fields(b)
+	if !slices.Equal(numberTokens(aTokens), numberTokens(bTokens)) {
+		return 0
+	}
+	coverage := tokenCoverage(aTokens, bTokens)
+	slices.Sort(aTokens)
+	slices.Sort(bTokens)
+	return coverage * max(jaroWinkler(a, b), jaroWinkler(strings.Join(aTokens, " "), strings.Join(bTokens, " ")))
+}
+
+// tokenCoverage returns the share of the letters of both names that belong to words with a
+// similar word in the other name
+func tokenCoverage(a, b []string) float64 {
+	total, unmatched := 0, 0
+	count := func(tokens, other []string) {
+		for _, t := range tokens {
+			n := len([]rune(t))
+			total += n
+			if !slices.ContainsFunc(other, func(o string) bool { return jaroWinkler(t, o) >= tokenMatchThreshold }) {
+				unmatched += n
+			}
+		}
+	}
+	count(a, b)
+	count(b, a)
+	if total == 0 {
+		return 1
+	}
+	return 1 - float64(unmatched)/float64(total)
+}
+
+// artistSimilarity returns the best similarity of a normalized library artist to any of the given names
+func artistSimilarity(names []string, artist string) float64 {
+	var best float64
+	for _, name := range names {
+		best = max(best, similarity(name, artist))
+	}
+	return best
+}
+
+// numberTokens returns the sorted number-like tokens: numbers, including spelled-out ones
+// and the digits within words such as "lp2", and roman numerals
+func numberTokens(tokens []string) []string {
+	var numbers []string
+	for _, t := range tokens {
+		switch {
+		case numberToken.MatchString(t):
+			numbers = append(numbers, t)
+		case spelledNumbers[t] != "":
+			numbers = append(numbers, spelledNumbers[t])
+		default:
+			numbers = append(numbers, tokenDigits.FindAllString(t, -1)...)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings, which favours strings
+// sharing a common prefix
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		if len(ra) == len(rb) {
+			return 1
+		}
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	window = max(window, 0)
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+
+	matches := 0
+	for i := range ra {
+		for j := max(0, i-window); j < min(len(rb), i+window+1); j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
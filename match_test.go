@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"martha", "marhta", 0.961},
+		{"dwayne", "duane", 0.840},
+		{"dixon", "dicksonx", 0.813},
+		{"same", "same", 1},
+		{"abc", "xyz", 0},
+		{"", "", 1},
+		{"", "a", 0},
+	}
+
+	for _, tt := range tests {
+		if got := jaroWinkler(tt.a, tt.b); math.Abs(got-tt.expected) > 0.001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f, expected %.3f", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"Parasomnia", "Parasomnia (Live)", 1, 1},
+		{"Parasomnia", "Parasomnai", 0.95, 1},
+		{"Parasomnia - 24-bit HD audio", "Parasomnia", 0, 0},
+		{"Live at X [Remastered]", "Live at X", 0.5, 0.6},
+		{"The Beatles", "Beatles", 0.7, 0.8},
+		{"Dream Theatre", "Dream Theater", 0.95, 1},
+		{"Sigur Ros", "Sigur Rós", 0.9, 1},
+		{"Greatest Hits Volume Two", "Greatest Hits Vol. 2", 0.8, 0.9},
+		{"The Marshall Mathers LP", "The Marshall Mathers LP2", 0, 0},
+		{"Wembley Live", "Live Wembley", 1, 1},
+		{"Greatest Hits", "Greatest Hits Vol. 2", 0, 0},
+		{"Album 1", "Album 2", 0, 0},
+		{"II", "III", 0, 0},
+		{"Images and Words", "Awake", 0, 0.7},
+	}
+
+	for _, tt := range tests {
+		got := similarity(normalizeName(tt.a), normalizeName(tt.b))
+		if got < tt.min || got > tt.max {
+			t.Errorf("similarity(%q, %q) = %.3f, expected between %.2f and %.2f", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestMatcherBest(t *testing.T) {
+	candidates := []matchCandidate{
+		{Artist: "Dream Theater", Title: "Images and Words"},
+		{Artist: "Dream Theater", Title: "Parasomnai"},
+		{Artist: "Dream Theatre", Title: "Awake"},
+	}
+
+	tests := []struct {
+		threshold float64
+		artist    string
+		album     string
+		expected  string
+		ok        bool
+	}{
+		{1, "Dream Theater", "Images And Words (Remastered)", "Images and Words", true},
+		{1, "Dream Theater", "Parasomnia", "", false},
+		{0.95, "Dream Theater", "Parasomnia", "Parasomnai", true},
+		{0.99, "Dream Theater", "Parasomnia", "Parasomnai", false},
+		{0.9, "Dream Theater", "Awake", "Awake", true},
+		{0.9, "Dream Theater", "Octavarium", "", false},
+	}
+
+	for _, tt := range tests {
+		m := &Matcher{Threshold: tt.threshold}
+		best, score, ok := m.Best(testAlbum(tt.artist, tt.album), candidates)
+		if ok != tt.ok || (tt.expected != "" && best.Title != tt.expected) {
+			t.Errorf("threshold %.2f, %s: got %q (score %.2f, ok %v), expected %q (ok %v)",
+				tt.threshold, tt.album, best.Title, score, ok, tt.expected, tt.ok)
+		}
+	}
+
+	var nilMatcher *Matcher
+	if _, _, ok := nilMatcher.Best(testAlbum("Dream Theater", "Parasomnia"), candidates); ok {
+		t.Error("Expected a nil matcher to require equal names")
+	}
+}
+
+func TestMatcherRejectsDifferentAlbums(t *testing.T) {
+	normalizer, err := NewNormalizer(true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalizer.EnableSteps(normalizeSteps)
+	m := &Matcher{Threshold: 0.9, Normalizer: normalizer}
+
+	tests := []struct {
+		artist, album, library string
+	}{
+		{"Fleetwood Mac", "Rumours", "Rumours Live"},
+		{"Tool", "Lateralus", "Lateralus Live"},
+		{"Queen", "Greatest Hits", "Greatest Hits Volume Two"},
+		{"Eminem", "The Marshall Mathers LP", "The Marshall Mathers LP2"},
+		{"The Beatles", "Let It Be", "Let It Be... Naked"},
+	}
+	for _, tt := range tests {
+		candidates := []matchCandidate{{Artist: tt.artist, Title: tt.library}}
+		if best, score, ok := m.Best(testAlbum(tt.artist, tt.album), candidates); ok {
+			t.Errorf("%s: expected no match, got %q (score %.3f)", tt.album, best.Title, score)
+		}
+	}
+}
+
+func TestMatcherFingerprint(t *testing.T) {
+	normalizer := func(defaults bool, steps ...string) *Normalizer {
+		n, err := NewNormalizer(defaults, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.EnableSteps(steps)
+		return n
+	}
+	base := &Matcher{Normalizer: normalizer(true, stepFold)}
+
+	if got := (&Matcher{Threshold: 1, Normalizer: normalizer(true, stepFold), Log: &bytes.Buffer{}}).Fingerprint(); got != base.Fingerprint() {
+		t.Errorf("Expected the same settings to give the same fingerprint, got %s and %s", got, base.Fingerprint())
+	}
+	if (*Matcher)(nil).Fingerprint() != (&Matcher{}).Fingerprint() {
+		t.Error("Expected a nil matcher to have the fingerprint of an empty one")
+	}
+
+	others := []*Matcher{
+		{Threshold: 0.9, Normalizer: normalizer(true, stepFold)},
+		{Normalizer: normalizer(false, stepFold)},
+		{Normalizer: normalizer(true, stepFold, stepArticle)},
+		{Normalizer: normalizer(true, stepFold), Aliases: []ArtistAlias{{Artist: "坂本龍一", Library: []string{"Ryuichi Sakamoto"}}}},
+	}
+	for i, m := range others {
+		if m.Fingerprint() == base.Fingerprint() {
+			t.Errorf("Matcher %d: expected a different fingerprint than %s", i, base.Fingerprint())
+		}
+	}
+}
+
+func TestMatcherLog(t *testing.T) {
+	var log bytes.Buffer
+	m := &Matcher{Threshold: 0.9, Log: &log}
+	candidates := []matchCandidate{{Artist: "Dream Theater", Title: "Parasomnia"}}
+
+	m.Best(testAlbum("Dream Theater", "Parasomnia"), candidates)
+	if log.Len() != 0 {
+		t.Errorf("Expected exact matches not to be logged, got %q", log.String())
+	}
+
+	m.Best(testAlbum("Dream Theater", "Parasomnai"), candidates)
+	if !strings.Contains(log.String(), "Matched 'Dream Theater - Parasomnai' to library album 'Dream Theater - Parasomnia' (score 0.98)") {
+		t.Errorf("Expected the fuzzy match to be logged, got %q", log.String())
+	}
+
+	log.Reset()
+	m.Best(testAlbum("Dream Theater", "Parasomnia Live"), candidates)
+	if !strings.Contains(log.String(), "Closest library album to 'Dream Theater - Parasomnia Live' is 'Dream Theater - Parasomnia' (score 0.78, threshold 0.90)") {
+		t.Errorf("Expected the rejected candidate to be logged, got %q", log.String())
+	}
+}
+
+func TestLibraryIndexFuzzyMatch(t *testing.T) {
+	var offsets []int
+	server := newAlbumListServer(t, 3, &offsets)
+	defer server.Close()
+
+	client := NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass")
+	client.matcher = &Matcher{Threshold: 0.9, Normalizer: &Normalizer{DropArticle: true}}
+	index, err := LoadLibraryIndex(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		artist   string
+		album    string
+		expected bool
+	}{
+		{"The Artist", "Album 1", true},
+		{"Artist", "Album 1", true},
+		{"The Artsit", "Album 2", true},
+		{"The Artist", "Album 5", false},
+		{"Someone Else", "Album 1", false},
+	}
+
+	for _, tt := range tests {
+		exists, err := index.HasAlbum(context.Background(), testAlbum(tt.artist, tt.album))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != tt.expected {
+			t.Errorf("%s - %s: expected %v, got %v", tt.artist, tt.album, tt.expected, exists)
+		}
+	}
+}
+
+func TestMatcherMatchMBID(t *testing.T) {
+	const mbid = "b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"
+	candidates := []matchCandidate{
+		{Artist: "Dream Theater", Title: "Parasomnia", MBID: "0a9c7a6e-0000-4000-8000-000000000000"},
+		{Artist: "ドリーム・シアター", Title: "パラソムニア", MBID: strings.ToUpper(mbid)},
+	}
+	matcher := &Matcher{Threshold: 1}
+
+	album := testAlbum("Dream Theater", "Parasomnia")
+	album.MBID = mbid
+	if match := matcher.Match(album, candidates); !match.Owned || match.By != matchByMBID {
+		t.Errorf("Expected a match by MusicBrainz ID, got %+v", match)
+	}
+
+	album.MBID = "ffffffff-0000-4000-8000-000000000000"
+	if match := matcher.Match(album, candidates); !match.Owned || match.By != matchByName {
+		t.Errorf("Expected a different MusicBrainz ID to fall back to the name, got %+v", match)
+	}
+
+	album = testAlbum("Dream Theater", "Awake")
+	if match := matcher.Match(album, candidates); match.Owned || match.By != "" {
+		t.Errorf("Expected no match, got %+v", match)
+	}
+}
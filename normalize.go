@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization steps that can be turned on and off with NORMALIZE
+const (
+	stepFold    = "fold"
+	stepAnd     = "and"
+	stepArticle = "article"
+)
+
+// normalizeSteps lists every normalization step in the order they are applied
+var normalizeSteps = []string{stepFold, stepAnd, stepArticle}
+
+// defaultEditionRules describe suffixes of album titles that name an edition or version
+// rather than a different album. Each rule has to match a whole suffix, ignoring case.
+var defaultEditionRules = []string{
+	`.*\bedition`,                                   // Deluxe Edition, 25th Anniversary Edition
+	`.*\bremaster(ed)?\b.*`,                         // 2011 Remaster, Remastered 2009
+	`(super )?deluxe( version| box set)?`,           // Deluxe, Deluxe Version
+	`expanded( version)?`,                           // Expanded
+	`.*\banniversary\b.*`,                           // 40th Anniversary
+	`(with )?bonus tracks?( version)?`,              // Bonus Track Version
+	`(single|ep|single version)`,                    // - Single, - EP
+	`\d+[- ]?bit( \d+(\.\d+)?k?hz)?( hd)?( audio)?`, // 24-bit HD audio, 24bit 96kHz
+	`hd( audio)?|hi-?res|high resolution`,           // HD audio, Hi-Res
+	`(mono|stereo)( version| mix)?`,                 // Mono, Stereo Mix
+	`(\d{4} )?reissue`,                              // Reissue, 2015 Reissue
+}
+
+// editionSuffix splits a title into its last suffix: a trailing (...) or [...] group, or the
+// text after the last " - ", " – ", " — " or ": "
+var editionSuffix = regexp.MustCompile(`^(.*\S)\s*(?:\(([^()]*)\)|\[([^\[\]]*)\]|\s[-–—]\s+(.*)|:\s+(.*))$`)
+
+// Normalizer turns album and artist names into the form in which they are compared. A nil
+// Normalizer only applies cleanString and ignores case.
+type Normalizer struct {
+	EditionRules   []*regexp.Regexp // suffixes stripped from album titles
+	FoldDiacritics bool             // "Björk" as "Bjork", "Æon" as "Aeon", full-width as ASCII
+	FoldAnd        bool             // "&" and "+" as "and"
+	DropArticle    bool             // artists without a leading "The", or a trailing ", The"
+}
+
+// NewNormalizer compiles edition rules, which are added to the built-in ones if defaults is set
+func NewNormalizer(defaults bool, rules []string) (*Normalizer, error) {
+	if defaults {
+		rules = append(append([]string{}, defaultEditionRules...), rules...)
+	}
+
+	n := &Normalizer{}
+	for _, rule := range rules {
+		re, err := compileEditionRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		n.EditionRules = append(n.EditionRules, re)
+	}
+	return n, nil
+}
+
+// EnableSteps turns on the named normalization steps
+func (n *Normalizer) EnableSteps(steps []string) {
+	for _, step := range steps {
+		switch step {
+		case stepFold:
+			n.FoldDiacritics = true
+		case stepAnd:
+			n.FoldAnd = true
+		case stepArticle:
+			n.DropArticle = true
+		}
+	}
+}
+
+// compileEditionRule compiles a rule so that it matches a whole suffix, ignoring case
+func compileEditionRule(rule string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(`(?i)^(?:` + rule + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid edition rule %q: %w", rule, err)
+	}
+	return re, nil
+}
+
+// loadEditionRules reads edition rules from filePath, one regular expression per line,
+// skipping blank lines and # comments. Invalid rules are reported as warnings on stderr.
+func loadEditionRules(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading edition rules: %w", err)
+	}
+	defer file.Close()
+
+	rules, warnings, err := parseEditionRules(file)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s:%s\n", filePath, warning)
+	}
+	return rules, err
+}
+
+// parseEditionRules parses edition rules, returning problems with single lines as "line N: problem"
+func parseEditionRules(r io.Reader) (rules, warnings []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := compileEditionRule(line); err != nil {
+			warnings = append(warnings, fmt.Sprintf("line %d: %v", lineNum, err))
+			continue
+		}
+		rules = append(rules, line)
+	}
+	return rules, warnings, scanner.Err()
+}
+
+// StripEdition removes edition suffixes from the end of an album title, one after the other,
+// as in "Album - Deluxe Edition [2011 Remaster]". A title is never stripped down to nothing.
+func (n *Normalizer) StripEdition(title string) string {
+	title = strings.TrimSpace(title)
+	if n == nil {
+		return title
+	}
+
+	for {
+		m := editionSuffix.FindStringSubmatch(title)
+		if m == nil {
+			return title
+		}
+		suffix := strings.TrimSpace(m[2] + m[3] + m[4] + m[5])
+		if !n.isEdition(suffix) {
+			return title
+		}
+		title = m[1]
+	}
+}
+
+// isEdition reports whether a title suffix matches one of the edition rules
+func (n *Normalizer) isEdition(suffix string) bool {
+	for _, re := range n.EditionRules {
+		if re.MatchString(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Title returns the comparable form of an album title
+func (n *Normalizer) Title(title string) string {
+	return normalizeName(n.StripEdition(n.fold(title)))
+}
+
+// Artist returns the comparable form of an artist name
+func (n *Normalizer) Artist(artist string) string {
+	artist = n.fold(artist)
+	if n == nil || !n.DropArticle {
+		return normalizeName(artist)
+	}
+
+	artist = normalizeName(trailingArticle.ReplaceAllString(artist, ""))
+	if rest, ok := strings.CutPrefix(artist, "the "); ok {
+		return rest
+	}
+	return artist
+}
+
+// fold applies the enabled character folding steps
+func (n *Normalizer) fold(s string) string {
+	if n == nil {
+		return s
+	}
+	if n.FoldDiacritics {
+		s = foldDiacritics(s)
+	}
+	if n.FoldAnd {
+		s = andVariants.ReplaceAllString(s, " and ")
+	}
+	return s
+}
+
+// Key builds a lookup key from the comparable artist and title
+func (n *Normalizer) Key(artist, title string) string {
+	return n.Artist(artist) + "\x00" + n.Title(title)
+}
+
+// normalizeName returns the form in which names are compared
+func normalizeName(s string) string {
+	return strings.ToLower(cleanString(s))
+}
+
+// andVariants matches "&" anywhere and "+" between words
+var andVariants = regexp.MustCompile(`\s*&\s*|\s+\+\s+`)
+
+// trailingArticle matches the article of library-sorted names such as "Beatles, The"
+var trailingArticle = regexp.MustCompile(`(?i)\s*,\s*the\s*$`)
+
+// letterFolds spells out the letters that NFKD leaves alone, as they have no decomposition
+var letterFolds = map[rune]string{
+	'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ß': "ss", 'ẞ': "SS", 'þ': "th", 'Þ': "TH",
+	'ø': "o", 'Ø': "O", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'ł': "l", 'Ł': "L", 'ħ': "h", 'Ħ': "H", 'ı': "i",
+}
+
+// diacriticMark reports whether r is a combining mark to drop after NFKD decomposition. The
+// kana voicing marks are kept, as "ガ" and "カ" are different syllables rather than accented ones.
+func diacriticMark(r rune) bool {
+	return unicode.Is(unicode.Mn, r) && r != '\u3099' && r != '\u309A'
+}
+
+// foldDiacritics applies NFKD decomposition, which also turns ligatures and full-width and
+// other compatibility characters into their plain form, drops the combining marks it splits
+// off, spells out the letters of letterFolds and recomposes what is left with NFC
+func foldDiacritics(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(s) {
+		if diacriticMark(r) {
+			continue
+		}
+		if plain, ok := letterFolds[r]; ok {
+			b.WriteString(plain)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
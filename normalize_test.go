@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStripEditionCorpus(t *testing.T) {
+	normalizer, err := NewNormalizer(true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open("testdata/edition_titles.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		title, expected, ok := strings.Cut(line, "\t")
+		if !ok {
+			t.Fatalf("line %d: expected a title and the expected title separated by a tab", lineNum)
+		}
+		if got := normalizer.StripEdition(title); got != expected {
+			t.Errorf("line %d: StripEdition(%q) = %q, expected %q", lineNum, title, got, expected)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizerCustomRules(t *testing.T) {
+	normalizer, err := NewNormalizer(false, []string{`live`, `.*\bremix`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"Alive - Live":                      "Alive",
+		"Sgt. Pepper's - 2017 Remix":        "Sgt. Pepper's",
+		"Abbey Road (Remastered)":           "Abbey Road (Remastered)",
+		"Abbey Road - Super Deluxe Edition": "Abbey Road - Super Deluxe Edition",
+		"  Padded Title - Live  ":           "Padded Title",
+		"Live":                              "Live",
+	}
+	for title, expected := range tests {
+		if got := normalizer.StripEdition(title); got != expected {
+			t.Errorf("StripEdition(%q) = %q, expected %q", title, got, expected)
+		}
+	}
+
+	if _, err := NewNormalizer(true, []string{"(unclosed"}); err == nil {
+		t.Error("Expected an invalid rule to be rejected")
+	}
+}
+
+func TestNilNormalizer(t *testing.T) {
+	var normalizer *Normalizer
+	if got := normalizer.StripEdition(" Abbey Road - Remastered "); got != "Abbey Road - Remastered" {
+		t.Errorf("Expected a nil normalizer to keep edition suffixes, got %q", got)
+	}
+	if got := normalizer.Key("The Beatles", "Abbey Road (Remastered)"); got != albumKey("The Beatles", "Abbey Road") {
+		t.Errorf("Expected a nil normalizer to build album keys, got %q", got)
+	}
+}
+
+func TestParseEditionRules(t *testing.T) {
+	rules, warnings, err := parseEditionRules(strings.NewReader("# extra rules\n\nlive\n(broken\n  .*\\bremix  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rules, "|") != `live|.*\bremix` {
+		t.Errorf("Unexpected rules %q", rules)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "line 4: invalid edition rule") {
+		t.Errorf("Expected a warning for line 4, got %q", warnings)
+	}
+}
+
+func TestHasAlbumStripsEditionsOnBothSides(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{"album":[` +
+			`{"name":"Parasomnia [24-bit HD audio]","artist":"Dream Theater"}]}}}`))
+	}))
+	defer server.Close()
+
+	normalizer, err := NewNormalizer(true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass")
+	client.matcher = &Matcher{Threshold: 1, Normalizer: normalizer}
+
+	exists, err := client.HasAlbum(context.Background(), testAlbum("Dream Theater", "Parasomnia - Deluxe Edition"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("Expected the album to match once the editions are stripped from both titles")
+	}
+	if len(queries) != 1 || queries[0] != "Parasomnia" {
+		t.Errorf("Expected the search to leave out the edition, got %q", queries)
+	}
+}
+
+func TestFoldDiacritics(t *testing.T) {
+	tests := map[string]string{
+		"Björk":               "Bjork",
+		"Sigur Rós":           "Sigur Ros",
+		"Ágætis byrjun":       "Agaetis byrjun",
+		"Motörhead":           "Motorhead",
+		"Mötley Crüe":         "Motley Crue",
+		"Œuvre":               "OEuvre",
+		"Die Ärzte – Straßen": "Die Arzte – Strassen",
+		"Þursaflokkurinn":     "THursaflokkurinn",
+		"Łona":                "Lona",
+		"Røyksopp":            "Royksopp",
+		"Đorđe Balašević":     "Dorde Balasevic",
+		"Sơn Tùng M-TP":       "Son Tung M-TP",
+		"Ｔｈｅ　Ｗａｌｌ":            "The Wall",
+		"Vol. ²":              "Vol. 2",
+		"Symphony ①":          "Symphony 1",
+		"ガガガSP":               "ガガガSP",
+		"방탄소년단":               "방탄소년단",
+		"ﬁnal ﬂight":          "final flight",
+		"Ｐｅｒｆｕｍｅ　３":           "Perfume 3",
+		"Beyoncé":            "Beyonce",
+		"坂本龍一":                "坂本龍一",
+		"Плохое предчувствие": "Плохое предчувствие",
+	}
+	for in, expected := range tests {
+		if got := foldDiacritics(in); got != expected {
+			t.Errorf("foldDiacritics(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestNormalizerSteps(t *testing.T) {
+	tests := []struct {
+		steps  []string
+		artist string
+		title  string
+		key    string
+	}{
+		{nil, "Björk", "Homogenic", "björk\x00homogenic"},
+		{[]string{stepFold}, "Björk", "Homogenic", "bjork\x00homogenic"},
+		{[]string{stepFold}, "Ｐｅｒｆｕｍｅ", "ＧＡＭＥ （Deluxe Edition）", "perfume\x00game"},
+		{nil, "Simon & Garfunkel", "Bookends", "simon garfunkel\x00bookends"},
+		{[]string{stepAnd}, "Simon & Garfunkel", "Bookends", "simon and garfunkel\x00bookends"},
+		{[]string{stepAnd}, "Simon and Garfunkel", "Bookends", "simon and garfunkel\x00bookends"},
+		{[]string{stepAnd}, "Florence + the Machine", "Lungs", "florence and the machine\x00lungs"},
+		{[]string{stepAnd}, "Blink-182", "Enema of the State", "blink182\x00enema of the state"},
+		{[]string{stepAnd}, "Nick Cave", "Kicking&Screaming", "nick cave\x00kicking and screaming"},
+		{nil, "The Beatles", "The White Album", "the beatles\x00the white album"},
+		{[]string{stepArticle}, "The Beatles", "The White Album", "beatles\x00the white album"},
+		{[]string{stepArticle}, "Beatles, The", "Help!", "beatles\x00help"},
+		{[]string{stepArticle}, "The The", "Soul Mining", "the\x00soul mining"},
+		{[]string{stepArticle}, "Theatre of Tragedy", "Aégis", "theatre of tragedy\x00aégis"},
+		{normalizeSteps, "The Dø & Friends", "Shake Shook Shaken", "do and friends\x00shake shook shaken"},
+	}
+
+	for _, tt := range tests {
+		normalizer, err := NewNormalizer(true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		normalizer.EnableSteps(tt.steps)
+		if got := normalizer.Key(tt.artist, tt.title); got != tt.key {
+			t.Errorf("steps %v: Key(%q, %q) = %q, expected %q", tt.steps, tt.artist, tt.title, got, tt.key)
+		}
+	}
+}
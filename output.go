@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// reportVersion is bumped whenever the machine-readable report layout changes incompatibly
+const reportVersion = 1
+
+// Report is the machine-readable result of a recommendation run
+type Report struct {
+	Version         int              `json:"version"`
+	GeneratedAt     time.Time        `json:"generated_at"`
+	User            string           `json:"user"`
+	Period          string           `json:"period"`
+	Recommendations []Recommendation `json:"recommendations"`
+	Resolved        []Recommendation `json:"resolved,omitempty"` // previously recommended albums now in the library, with --diff
+	Partial         []Recommendation `json:"partial,omitempty"`  // albums partly in the library, with --partial report
+	Ignored         int              `json:"ignored"`
+	Snoozed         int              `json:"snoozed"`
+	Matches         MatchStats       `json:"matches"` // how the top albums found in the library were matched
+	Stats           ErrorStats       `json:"stats"`
+}
+
+// Recommendation is a single missing album in a Report
+type Recommendation struct {
+	Rank      int     `json:"rank"`
+	Artist    string  `json:"artist"`
+	Album     string  `json:"album"`
+	PlayCount int     `json:"playcount"`
+	URL       string  `json:"url"`
+	MBID      string  `json:"mbid"`
+	Image     string  `json:"image"`
+	Score     float64 `json:"score"`
+
+	// OwnedTracks and Tracks tell how much of a partially owned album is in the library
+	OwnedTracks int `json:"owned_tracks,omitempty"`
+	Tracks      int `json:"tracks,omitempty"`
+
+	// MissingTracks lists the missing top tracks an album is recommended for, by the tracks command
+	MissingTracks []MissingTrack `json:"missing_tracks,omitempty"`
+
+	// Status and FirstSeen compare the album with the previous run, with --diff
+	Status    string     `json:"status,omitempty"`
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+}
+
+// outputFormats maps the supported --format values to their report writers
+var outputFormats = map[string]func(w io.Writer, report *Report) error{
+	"text":     printRecommendation,
+	"json":     writeJSONReport,
+	"csv":      writeCSVReport,
+	"markdown": writeMarkdownReport,
+}
+
+// reportColumn is a column of the tabular output formats
+type reportColumn struct {
+	name     string // CSV header, matching the JSON field name
+	title    string // Markdown header
+	value    func(r Recommendation) string
+	markdown func(r Recommendation) string // optional Markdown rendering of the value
+}
+
+// reportColumns are the columns of the tabular output formats, matching the JSON recommendation fields
+var reportColumns = []reportColumn{
+	{name: "rank", title: "Rank", value: func(r Recommendation) string { return strconv.Itoa(r.Rank) }},
+	{name: "artist", title: "Artist", value: func(r Recommendation) string { return r.Artist }},
+	{name: "album", title: "Album", value: func(r Recommendation) string { return r.Album }},
+	{name: "playcount", title: "Plays", value: func(r Recommendation) string { return strconv.Itoa(r.PlayCount) }},
+	{name: "score", title: "Score", value: func(r Recommendation) string { return strconv.FormatFloat(r.Score, 'f', 3, 64) }},
+	{name: "url", title: "Last.fm URL", value: func(r Recommendation) string { return r.URL }},
+	{name: "image", title: "Cover", value: func(r Recommendation) string { return r.Image }, markdown: markdownImage},
+	{name: "status", title: "Status", value: func(r Recommendation) string { return r.Status }},
+	{name: "owned", title: "Owned", value: ownedText},
+}
+
+// statusPartial marks albums partly in the library in the tabular output formats
+const statusPartial = "PARTIAL"
+
+// ownedText gives the share of a partially owned album's tracks that are in the library
+func ownedText(r Recommendation) string {
+	if r.Tracks == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%%", ownedPercent(r.OwnedTracks, r.Tracks))
+}
+
+// markdownImage renders the cover art as an inline Markdown image
+func markdownImage(r Recommendation) string {
+	if r.Image == "" {
+		return ""
+	}
+	return fmt.Sprintf("![%s](%s)", markdownEscaper.Replace(r.Album), r.Image)
+}
+
+// outputFormatNames returns the supported output formats in alphabetical order
+func outputFormatNames() []string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newReport builds the report for a finished run
+func newReport(cfg *Config, result *CheckResult) *Report {
+	report := &Report{
+		Version:         reportVersion,
+		GeneratedAt:     time.Now().UTC(),
+		User:            cfg.LastFMUser,
+		Period:          cfg.LastFMPeriod,
+		Recommendations: make([]Recommendation, 0, len(result.Missing)),
+		Ignored:         result.Ignored,
+		Snoozed:         result.Snoozed,
+		Matches:         result.Matches,
+		Stats:           result.Stats,
+	}
+
+	for _, album := range result.Missing {
+		report.Recommendations = append(report.Recommendations, newRecommendation(album))
+	}
+	// Partial albums are among the recommendations when they are recommended
+	if cfg.PartialAlbums == partialReport {
+		for _, album := range result.Partial {
+			report.Partial = append(report.Partial, newRecommendation(album))
+		}
+	}
+
+	return report
+}
+
+// newRecommendation describes an album of the report
+func newRecommendation(album *Album) Recommendation {
+	return Recommendation{
+		Rank:        int(album.Attr.Rank),
+		Artist:      album.Artist.Name,
+		Album:       album.Name,
+		PlayCount:   int(album.PlayCount),
+		URL:         album.URL,
+		MBID:        album.MBID,
+		Image:       album.ImageURL(),
+		Score:       album.Score,
+		OwnedTracks: album.Songs,
+		Tracks:      album.Tracks,
+	}
+}
+
+// rows returns the recommendations followed by the resolved and the partial albums, for the
+// tabular output formats
+func (r *Report) rows() []Recommendation {
+	rows := append(slices.Clip(r.Recommendations), r.Resolved...)
+	for _, rec := range r.Partial {
+		rec.Status = statusPartial
+		rows = append(rows, rec)
+	}
+	return rows
+}
+
+// writeReport renders the report in the given output format
+func writeReport(w io.Writer, format string, report *Report) error {
+	write, ok := outputFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	return write(w, report)
+}
+
+// writeJSONReport writes the report as an indented JSON document
+func writeJSONReport(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// writeCSVReport writes the recommendations as CSV with a header row
+func writeCSVReport(w io.Writer, report *Report) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(reportColumns))
+	for i, col := range reportColumns {
+		header[i] = col.name
+	}
+	cw.Write(header)
+
+	for _, rec := range report.rows() {
+		row := make([]string, len(reportColumns))
+		for i, col := range reportColumns {
+			row[i] = col.value(rec)
+		}
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// markdownEscaper escapes characters that would break a Markdown table cell
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\n", " ")
+
+// writeMarkdownReport writes the recommendations as a Markdown table
+func writeMarkdownReport(w io.Writer, report *Report) error {
+	fmt.Fprintf(w, "## Recommended albums (%s)\n\n", lastFMPeriods[report.Period])
+
+	header := make([]string, len(reportColumns))
+	for i, col := range reportColumns {
+		header[i] = col.title
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(reportColumns)))
+
+	for _, rec := range report.rows() {
+		cells := make([]string, len(reportColumns))
+		for i, col := range reportColumns {
+			if col.markdown != nil {
+				cells[i] = col.markdown(rec)
+			} else {
+				cells[i] = markdownEscaper.Replace(col.value(rec))
+			}
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printRecommendation writes the error statistics and displays the list of recommended
+// albums in a formatted table, naming the Last.fm period the recommendations are based on
+func printRecommendation(out io.Writer, report *Report) error {
+	printErrorStats(out, report.Stats)
+
+	if len(report.Recommendations) == 0 {
+		fmt.Fprintf(out, "All top albums (%s) exist in your Subsonic library!\n", lastFMPeriods[report.Period])
+		printResolved(out, report.Resolved)
+		printPartial(out, report.Partial)
+		printSnoozed(out, report.Snoozed)
+		printMatches(out, report.Matches)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "RECOMMENDED ALBUMS (%s)\t\n", lastFMPeriods[report.Period])
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	for i, rec := range report.Recommendations {
+		fmt.Fprintf(w, "%d. %s - %s%s\n", i+1, rec.Artist, rec.Album, statusText(rec))
+		if rec.PlayCount > 0 {
+			fmt.Fprintf(w, "   Played:\t%s (#%d in your top albums)\n", playCountText(rec.PlayCount), rec.Rank)
+		}
+		if rec.Tracks > 0 {
+			fmt.Fprintf(w, "   In library:\t%s\n", tracksText(rec))
+		}
+		fmt.Fprintf(w, "   Score:\t%.3f\n", rec.Score)
+		fmt.Fprintf(w, "   Last.fm URL:\t%s\n", rec.URL)
+		fmt.Fprintln(w, strings.Repeat("-", 80))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	printResolved(out, report.Resolved)
+	printPartial(out, report.Partial)
+	printSnoozed(out, report.Snoozed)
+	printMatches(out, report.Matches)
+	return nil
+}
+
+// statusText describes a recommendation's status relative to the previous run
+func statusText(rec Recommendation) string {
+	switch {
+	case rec.Status == "":
+		return ""
+	case rec.FirstSeen != nil:
+		return fmt.Sprintf("  [%s since %s]", rec.Status, rec.FirstSeen.Local().Format(time.DateOnly))
+	default:
+		return fmt.Sprintf("  [%s]", rec.Status)
+	}
+}
+
+// printResolved lists previously recommended albums that are now in the library
+func printResolved(out io.Writer, resolved []Recommendation) {
+	if len(resolved) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "\nRESOLVED SINCE LAST RUN")
+	for _, rec := range resolved {
+		fmt.Fprintf(out, "✓ %s - %s\n", rec.Artist, rec.Album)
+	}
+}
+
+// printPartial lists the albums partly in the library
+func printPartial(out io.Writer, partial []Recommendation) {
+	if len(partial) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "\nPARTLY IN LIBRARY")
+	for _, rec := range partial {
+		fmt.Fprintf(out, "◐ %s - %s (%s)\n", rec.Artist, rec.Album, tracksText(rec))
+	}
+}
+
+// tracksText describes how many of an album's tracks are in the library
+func tracksText(rec Recommendation) string {
+	return fmt.Sprintf("%d of %d tracks, %s", rec.OwnedTracks, rec.Tracks, ownedText(rec))
+}
+
+// printSnoozed reports how many albums were held back by active snoozes
+func printSnoozed(out io.Writer, snoozed int) {
+	switch snoozed {
+	case 0:
+	case 1:
+		fmt.Fprintln(out, "\n1 album is snoozed in the ignore file")
+	default:
+		fmt.Fprintf(out, "\n%d albums are snoozed in the ignore file\n", snoozed)
+	}
+}
+
+// printMatches reports how the albums found in the library were matched
+func printMatches(out io.Writer, matches MatchStats) {
+	if matches.MBID+matches.Name > 0 {
+		fmt.Fprintf(out, "\nIn library: %d matched by MusicBrainz ID, %d by name\n", matches.MBID, matches.Name)
+	}
+}
+
+// playCountText describes how often an album was played
+func playCountText(count int) string {
+	if count == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", count)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testMissingAlbums returns two missing albums with Last.fm rank and play count set
+func testMissingAlbums() []*Album {
+	first := &Album{Name: "Parasomnia", URL: "https://www.last.fm/music/Dream+Theater/Parasomnia", PlayCount: 312}
+	first.Artist.Name = "Dream Theater"
+	first.Attr.Rank = 3
+	first.MBID = "8c3a7a6b-4f1e-4b8a-9d2e-3f0c1a2b3c4d"
+	first.Image = []AlbumImage{
+		{URL: "https://lastfm.freetls.fastly.net/i/u/34s/cover.png", Size: "small"},
+		{URL: "https://lastfm.freetls.fastly.net/i/u/300x300/cover.png", Size: "extralarge"},
+	}
+
+	second := &Album{Name: "Obsidian", URL: "https://www.last.fm/music/Blue+Stahli/Obsidian", PlayCount: 87}
+	second.Artist.Name = "Blue Stahli"
+	second.Attr.Rank = 11
+
+	return []*Album{first, second}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	cfg := &Config{LastFMUser: "testuser", LastFMPeriod: "1month"}
+	result := &CheckResult{
+		Missing: testMissingAlbums(),
+		Stats:   ErrorStats{Total: 12, Successful: 11, Failed: 1, Network: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "json", newReport(cfg, result)); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Version         int    `json:"version"`
+		User            string `json:"user"`
+		Period          string `json:"period"`
+		Recommendations []struct {
+			Rank      int    `json:"rank"`
+			Artist    string `json:"artist"`
+			Album     string `json:"album"`
+			PlayCount int    `json:"playcount"`
+			URL       string `json:"url"`
+			MBID      string `json:"mbid"`
+			Image     string `json:"image"`
+		} `json:"recommendations"`
+		Stats map[string]int `json:"stats"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if doc.Version != reportVersion || doc.User != "testuser" || doc.Period != "1month" {
+		t.Errorf("Unexpected report header: %+v", doc)
+	}
+	if len(doc.Recommendations) != 2 {
+		t.Fatalf("Expected 2 recommendations, got %d", len(doc.Recommendations))
+	}
+
+	rec := doc.Recommendations[0]
+	if rec.MBID != "8c3a7a6b-4f1e-4b8a-9d2e-3f0c1a2b3c4d" || rec.Image != "https://lastfm.freetls.fastly.net/i/u/300x300/cover.png" {
+		t.Errorf("Expected mbid and largest image in first recommendation: %+v", rec)
+	}
+	if rec.Rank != 3 || rec.Artist != "Dream Theater" || rec.Album != "Parasomnia" || rec.PlayCount != 312 ||
+		rec.URL != "https://www.last.fm/music/Dream+Theater/Parasomnia" {
+		t.Errorf("Unexpected first recommendation: %+v", rec)
+	}
+
+	if doc.Stats["total"] != 12 || doc.Stats["failed"] != 1 || doc.Stats["network"] != 1 {
+		t.Errorf("Unexpected stats: %v", doc.Stats)
+	}
+}
+
+func TestWriteJSONReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "json", newReport(&Config{LastFMPeriod: "12month"}, &CheckResult{})); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `"recommendations": []`) {
+		t.Errorf("Expected empty recommendations array, got: %s", buf.String())
+	}
+}
+
+func TestWriteReportUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "yaml", &Report{}); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestPrintRecommendationIncludesErrorStats(t *testing.T) {
+	result := &CheckResult{Stats: ErrorStats{Total: 2, Successful: 1, Failed: 1, RateLimit: 1}}
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "text", newReport(&Config{LastFMPeriod: "12month"}, result)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "API Statistics: 1/2 requests successful (1 failed)") {
+		t.Errorf("Expected API statistics in text output, got: %s", buf.String())
+	}
+}
+
+func TestWriteCSVReport(t *testing.T) {
+	missing := testMissingAlbums()
+	missing[1].Name = `Obsidian, "Deluxe"`
+	missing[1].Score = 0.27885
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "csv", newReport(&Config{LastFMPeriod: "12month"}, &CheckResult{Missing: missing})); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Output is not valid CSV: %v", err)
+	}
+
+	expected := [][]string{
+		{"rank", "artist", "album", "playcount", "score", "url", "image", "status", "owned"},
+		{"3", "Dream Theater", "Parasomnia", "312", "0.000", "https://www.last.fm/music/Dream+Theater/Parasomnia", "https://lastfm.freetls.fastly.net/i/u/300x300/cover.png", "", ""},
+		{"11", "Blue Stahli", `Obsidian, "Deluxe"`, "87", "0.279", "https://www.last.fm/music/Blue+Stahli/Obsidian", "", "", ""},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(records))
+	}
+	for i := range expected {
+		if strings.Join(records[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("Record %d: expected %v, got %v", i, expected[i], records[i])
+		}
+	}
+}
+
+func TestWriteMarkdownReport(t *testing.T) {
+	missing := testMissingAlbums()
+	missing[0].Name = "Side A | Side B"
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "markdown", newReport(&Config{LastFMPeriod: "7day"}, &CheckResult{Missing: missing})); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"## Recommended albums (last 7 days)",
+		"",
+		"| Rank | Artist | Album | Plays | Score | Last.fm URL | Cover | Status | Owned |",
+		"| --- | --- | --- | --- | --- | --- | --- | --- | --- |",
+		`| 3 | Dream Theater | Side A \| Side B | 312 | 0.000 | https://www.last.fm/music/Dream+Theater/Parasomnia | ![Side A \| Side B](https://lastfm.freetls.fastly.net/i/u/300x300/cover.png) |  |  |`,
+		"| 11 | Blue Stahli | Obsidian | 87 | 0.000 | https://www.last.fm/music/Blue+Stahli/Obsidian |  |  |  |",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected Markdown output:\n%s", buf.String())
+	}
+}
+
+func TestPrintRecommendationPlayCount(t *testing.T) {
+	missing := testMissingAlbums()
+	missing[1].PlayCount = 1
+
+	var buf bytes.Buffer
+	if err := printRecommendation(&buf, newReport(&Config{LastFMPeriod: "12month"}, &CheckResult{Missing: missing})); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "312 times (#3 in your top albums)") {
+		t.Errorf("Expected play count and rank of first album, got: %s", output)
+	}
+	if !strings.Contains(output, "once (#11 in your top albums)") {
+		t.Errorf("Expected single play of second album, got: %s", output)
+	}
+}
+
+func TestReportMatches(t *testing.T) {
+	result := &CheckResult{Missing: testMissingAlbums(), Matches: MatchStats{MBID: 7, Name: 3}}
+	report := newReport(&Config{LastFMPeriod: "12month"}, result)
+
+	var text bytes.Buffer
+	if err := writeReport(&text, "text", report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(text.String(), "\nIn library: 7 matched by MusicBrainz ID, 3 by name\n") {
+		t.Errorf("Expected the match summary at the end, got: %s", text.String())
+	}
+
+	var doc bytes.Buffer
+	if err := writeReport(&doc, "json", report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.String(), `"matches": {
+    "mbid": 7,
+    "name": 3
+  }`) {
+		t.Errorf("Expected match counts in JSON output, got: %s", doc.String())
+	}
+}
+
+func TestReportPartialAlbums(t *testing.T) {
+	missing := testMissingAlbums()
+	missing[0].Songs, missing[0].Tracks = 4, 10
+	partial := testMissingAlbums()[1]
+	partial.Songs, partial.Tracks = 3, 12
+
+	cfg := &Config{LastFMPeriod: "12month", PartialAlbums: partialReport}
+	report := newReport(cfg, &CheckResult{Missing: missing[:1], Partial: []*Album{partial}})
+
+	var text bytes.Buffer
+	if err := writeReport(&text, "text", report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"In library:   4 of 10 tracks, 40%", "PARTLY IN LIBRARY\n◐ Blue Stahli - Obsidian (3 of 12 tracks, 25%)"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Expected text output to contain %q, got:\n%s", want, text.String())
+		}
+	}
+
+	var table bytes.Buffer
+	if err := writeReport(&table, "csv", report); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&table).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][8] != "40%" || records[2][7] != statusPartial || records[2][8] != "25%" {
+		t.Errorf("Expected the partial album as last CSV row, got %v", records)
+	}
+}
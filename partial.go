@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Ways of dealing with albums of which fewer songs are in the library than they have tracks on Last.fm
+const (
+	partialOwned     = "owned"     // count them as owned, without comparing track counts
+	partialReport    = "report"    // compare track counts and list partial albums separately
+	partialRecommend = "recommend" // recommend completing partial albums along with the missing ones
+)
+
+// partialModes lists the values of PARTIAL_ALBUMS
+var partialModes = []string{partialOwned, partialReport, partialRecommend}
+
+// trackCountCache remembers the song and track counts of owned albums between runs
+type trackCountCache interface {
+	TrackCounts(album Album) (songs, tracks int, ok bool)
+	RememberTrackCounts(album Album, songs, tracks int)
+}
+
+// TrackCountChecker compares the songs of every album another checker finds in the library
+// with the number of tracks of the album on Last.fm, so that albums of which only some
+// tracks are in the library can be told from complete ones. This costs an album.getInfo
+// request for every owned album, unless the wrapped checker is a cache that remembers the
+// counts.
+type TrackCountChecker struct {
+	checker  AlbumChecker
+	cache    trackCountCache // the wrapped checker, if it remembers counts
+	lastFM   *LastFMClient
+	subsonic *SubsonicClient // counts the songs of albums found without a song count
+
+	mu     sync.Mutex
+	failed int
+}
+
+// NewTrackCountChecker wraps checker, fetching track listings from lastFM
+func NewTrackCountChecker(checker AlbumChecker, lastFM *LastFMClient, subsonic *SubsonicClient) *TrackCountChecker {
+	cache, _ := checker.(trackCountCache)
+	return &TrackCountChecker{checker: checker, cache: cache, lastFM: lastFM, subsonic: subsonic}
+}
+
+// HasAlbum reports whether any of the album is in the library, partially or completely
+func (t *TrackCountChecker) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	match, err := t.MatchAlbum(ctx, album)
+	return match.Owned, err
+}
+
+// MatchAlbum looks the album up with the wrapped checker and, if it is in the library, adds
+// the number of its tracks on Last.fm. Albums without a track listing on Last.fm count as
+// complete. Counts are remembered by a caching checker, failed comparisons are not.
+func (t *TrackCountChecker) MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error) {
+	match, err := matchAlbum(ctx, t.checker, album)
+	if err != nil || !match.Owned {
+		return match, err
+	}
+	if t.cache != nil {
+		if songs, tracks, ok := t.cache.TrackCounts(album); ok {
+			match.Songs, match.Tracks = songs, tracks
+			return match, nil
+		}
+	}
+
+	if match.Songs == 0 && match.ID != "" && t.subsonic != nil {
+		match.Songs, err = t.subsonic.CountAlbumSongs(ctx, match.ID)
+	}
+	var info *AlbumInfo
+	if err == nil {
+		info, err = t.lastFM.GetAlbumInfo(ctx, album.Artist.Name, album.Name, "")
+	}
+
+	// An album that cannot be compared still counts as owned
+	if err != nil {
+		if ctx.Err() != nil {
+			return match, ctx.Err()
+		}
+		t.mu.Lock()
+		t.failed++
+		t.mu.Unlock()
+		match.Songs = 0
+		return match, nil
+	}
+	match.Tracks = len(info.Tracks.Track)
+	if t.cache != nil {
+		t.cache.RememberTrackCounts(album, match.Songs, match.Tracks)
+	}
+	return match, nil
+}
+
+// Failed returns how many owned albums could not be compared, mostly for lack of a Last.fm track listing
+func (t *TrackCountChecker) Failed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
+
+// ownedPercent returns how much of an album's tracks are in the library, rounded down
+func ownedPercent(songs, tracks int) int {
+	if tracks == 0 {
+		return 100
+	}
+	return songs * 100 / tracks
+}
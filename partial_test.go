@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLibrary is an AlbumMatchChecker owning the albums it has song counts for
+type fakeLibrary map[string]AlbumMatch
+
+func (f fakeLibrary) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	return f[album.Name].Owned, nil
+}
+
+func (f fakeLibrary) MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error) {
+	return f[album.Name], nil
+}
+
+// newTrackListingServer serves Last.fm track listings of the given number of tracks by album,
+// and errors for other albums, counting the requests in requests if it is not nil
+func newTrackListingServer(t *testing.T, tracks map[string]int, requests *atomic.Int64) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			requests.Add(1)
+		}
+		album := r.URL.Query().Get("album")
+		n, ok := tracks[album]
+		if !ok {
+			w.Write([]byte(`{"error":6,"message":"Album not found"}`))
+			return
+		}
+		var listing []string
+		for i := range n {
+			listing = append(listing, fmt.Sprintf(`{"name":"Track %d"}`, i+1))
+		}
+		fmt.Fprintf(w, `{"album":{"name":%q,"tracks":{"track":[%s]}}}`, album, strings.Join(listing, ","))
+	}))
+}
+
+func TestTrackCountChecker(t *testing.T) {
+	lastFM := newTrackListingServer(t, map[string]int{"Partial": 12, "Complete": 10, "Unknown Songs": 8}, nil)
+	defer lastFM.Close()
+	subsonic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("id"); !strings.HasSuffix(r.URL.Path, "/getAlbum.view") || id != "al-3" {
+			t.Errorf("Unexpected Subsonic request %s", r.URL)
+		}
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","album":{"id":"al-3","song":[{"id":"s1"},{"id":"s2"}]}}}`))
+	}))
+	defer subsonic.Close()
+
+	library := fakeLibrary{
+		"Partial":       {Owned: true, By: matchByName, ID: "al-1", Songs: 3},
+		"Complete":      {Owned: true, By: matchByName, ID: "al-2", Songs: 10},
+		"Unknown Songs": {Owned: true, By: matchByName, ID: "al-3"},
+		"No Listing":    {Owned: true, By: matchByName, ID: "al-4", Songs: 1},
+	}
+	lastFMClient := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: lastFM.URL + "/"}
+	checker := NewTrackCountChecker(library, lastFMClient, NewSubsonicClient(newHTTPClient(false), subsonic.URL, "u", "p"))
+
+	tests := []struct {
+		album         string
+		owned         bool
+		partial       bool
+		songs, tracks int
+	}{
+		{"Partial", true, true, 3, 12},
+		{"Complete", true, false, 10, 10},
+		{"Unknown Songs", true, true, 2, 8},
+		{"No Listing", true, false, 0, 0},
+		{"Missing", false, false, 0, 0},
+	}
+	for _, tt := range tests {
+		match, err := checker.MatchAlbum(context.Background(), testAlbum("Artist", tt.album))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match.Owned != tt.owned || match.Partial() != tt.partial || match.Songs != tt.songs || match.Tracks != tt.tracks {
+			t.Errorf("%s: unexpected match %+v", tt.album, match)
+		}
+	}
+	if checker.Failed() != 1 {
+		t.Errorf("Expected the album without a track listing to be counted, got %d", checker.Failed())
+	}
+}
+
+func TestTrackCountCheckerRemembersCounts(t *testing.T) {
+	var requests atomic.Int64
+	lastFM := newTrackListingServer(t, map[string]int{"Partial": 12}, &requests)
+	defer lastFM.Close()
+	lastFMClient := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: lastFM.URL + "/"}
+	library := &fakeMatchChecker{fakeChecker{owned: map[string]bool{"Partial": true, "No Listing": true}}}
+	path := filepath.Join(t.TempDir(), "lookups.json")
+	partial := testAlbum("Artist", "Partial")
+	partial.MBID = "b1f0d4a8-0f7a-4c7e-9d3f-6c4f0b8d2e11"
+
+	// The second run takes the track count of Partial from the cache but retries No Listing
+	for run, expected := range []int64{2, 1} {
+		cache, err := NewCachedChecker(library, path, "server", "", time.Hour, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checker := NewTrackCountChecker(cache, lastFMClient, nil)
+		requests.Store(0)
+
+		for _, album := range []Album{partial, testAlbum("Artist", "No Listing")} {
+			if _, err := checker.MatchAlbum(context.Background(), album); err != nil {
+				t.Fatal(err)
+			}
+		}
+		match, err := checker.MatchAlbum(context.Background(), partial)
+		if err != nil || match.Songs != 7 || match.Tracks != 12 {
+			t.Errorf("Run %d: expected Partial to be partly owned, got %+v (%v)", run+1, match, err)
+		}
+		if got := requests.Load(); got != expected {
+			t.Errorf("Run %d: expected %d album.getInfo requests, got %d", run+1, expected, got)
+		}
+		if err := cache.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindMissingAlbumsPartial(t *testing.T) {
+	lastFM := newTrackListingServer(t, map[string]int{"Partial": 12, "Complete": 10}, nil)
+	defer lastFM.Close()
+
+	library := fakeLibrary{
+		"Partial":  {Owned: true, By: matchByName, Songs: 3},
+		"Complete": {Owned: true, By: matchByName, Songs: 10},
+	}
+	lastFMClient := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: lastFM.URL + "/"}
+	var albums []Album
+	for _, name := range []string{"Partial", "Complete", "Missing"} {
+		albums = append(albums, testAlbum("Artist", name))
+	}
+
+	for mode, expected := range map[string]string{
+		partialReport:    "Missing",
+		partialRecommend: "Partial,Missing",
+	} {
+		checker := NewTrackCountChecker(library, lastFMClient, nil)
+		cfg := &Config{PartialAlbums: mode}
+		result, err := findMissingAlbums(context.Background(), checker, &albumSlice{albums: albums}, cfg, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, album := range result.Missing {
+			names = append(names, album.Name)
+		}
+		if got := strings.Join(names, ","); got != expected {
+			t.Errorf("%s: expected missing %s, got %s", mode, expected, got)
+		}
+		if len(result.Partial) != 1 || result.Partial[0].Songs != 3 || result.Partial[0].Tracks != 12 {
+			t.Errorf("%s: expected Partial to be partly owned, got %v", mode, result.Partial)
+		}
+
+		report := newReport(cfg, result)
+		if mode == partialReport && (len(report.Partial) != 1 || len(report.Recommendations) != 1) {
+			t.Errorf("Expected the partial album to be reported apart, got %+v", report)
+		}
+		if mode == partialRecommend && (len(report.Partial) != 0 || report.Recommendations[0].OwnedTracks != 3) {
+			t.Errorf("Expected the partial album among the recommendations, got %+v", report)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// scoreCandidateFactor is how many more missing albums than requested are collected
+	// when the scoring weights can reorder them
+	scoreCandidateFactor = 3
+	// scoreTopTrackLimit caps the number of top tracks fetched for the track coverage signal
+	scoreTopTrackLimit = 1000
+)
+
+// ScoreWeights configures how much each scoring signal contributes to an album's score.
+// A negative weight favours albums with a low signal value.
+type ScoreWeights struct {
+	PlayCount float64
+	Recency   float64
+	Tracks    float64
+	Artist    float64
+}
+
+// reorders reports whether the weights can rank albums differently from the Last.fm play count order
+func (w ScoreWeights) reorders() bool {
+	return w.Recency != 0 || w.Tracks != 0 || w.Artist != 0 || w.PlayCount < 0
+}
+
+// ScoreSignal computes one scoring signal for each candidate album, normalised to the range 0..1
+type ScoreSignal interface {
+	Name() string
+	Compute(ctx context.Context, albums []*Album) ([]float64, error)
+}
+
+// weightedSignal pairs a signal with its weight
+type weightedSignal struct {
+	signal ScoreSignal
+	weight float64
+}
+
+// Scorer ranks albums by a weighted sum of scoring signals
+type Scorer struct {
+	signals []weightedSignal
+}
+
+// NewScorer creates a scorer without any signals
+func NewScorer() *Scorer {
+	return &Scorer{}
+}
+
+// Add registers a signal with the given weight; signals with a zero weight are skipped
+func (s *Scorer) Add(signal ScoreSignal, weight float64) *Scorer {
+	if weight != 0 {
+		s.signals = append(s.signals, weightedSignal{signal: signal, weight: weight})
+	}
+	return s
+}
+
+// Score sets each album's Score and sorts the albums by descending score, keeping
+// the Last.fm order for ties. A signal that fails is skipped and its error returned
+// once every other signal has been applied.
+func (s *Scorer) Score(ctx context.Context, albums []*Album) error {
+	for _, album := range albums {
+		album.Score = 0
+	}
+
+	var errs []error
+	for _, ws := range s.signals {
+		values, err := ws.signal.Compute(ctx, albums)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s signal: %w", ws.signal.Name(), err))
+		}
+		if values == nil {
+			continue
+		}
+		for i, album := range albums {
+			album.Score += ws.weight * values[i]
+		}
+	}
+
+	sort.SliceStable(albums, func(i, j int) bool {
+		return albums[i].Score > albums[j].Score
+	})
+
+	return errors.Join(errs...)
+}
+
+// newScorer creates the scorer for the configured weights
+func newScorer(cfg *Config, lastFMClient *LastFMClient, subsonicClient *SubsonicClient) *Scorer {
+	return NewScorer().
+		Add(playCountSignal{}, cfg.ScoreWeights.PlayCount).
+		Add(&recencySignal{client: lastFMClient, user: cfg.LastFMUser, period: recencyPeriod(cfg.LastFMPeriod)}, cfg.ScoreWeights.Recency).
+		Add(&trackCoverageSignal{client: lastFMClient, user: cfg.LastFMUser, period: cfg.LastFMPeriod}, cfg.ScoreWeights.Tracks).
+		Add(&artistPresenceSignal{client: subsonicClient}, cfg.ScoreWeights.Artist)
+}
+
+// recencyPeriod picks the Last.fm period that counts as recent listening for a run over period
+func recencyPeriod(period string) string {
+	if period == "7day" || period == "1month" {
+		return "7day"
+	}
+	return "1month"
+}
+
+// normalize scales values so that the largest one becomes 1
+func normalize(values []float64) []float64 {
+	highest := 0.0
+	for _, v := range values {
+		highest = max(highest, v)
+	}
+	if highest == 0 {
+		return values
+	}
+	for i := range values {
+		values[i] /= highest
+	}
+	return values
+}
+
+// playCountSignal favours albums with more plays in the selected period
+type playCountSignal struct{}
+
+func (playCountSignal) Name() string {
+	return "playcount"
+}
+
+func (playCountSignal) Compute(ctx context.Context, albums []*Album) ([]float64, error) {
+	values := make([]float64, len(albums))
+	for i, album := range albums {
+		values[i] = float64(album.PlayCount)
+	}
+	return normalize(values), nil
+}
+
+// recencySignal favours albums that were played a lot recently
+type recencySignal struct {
+	client *LastFMClient
+	user   string
+	period string
+}
+
+func (r *recencySignal) Name() string {
+	return "recency"
+}
+
+func (r *recencySignal) Compute(ctx context.Context, albums []*Album) ([]float64, error) {
+	recent, err := r.client.GetTopAlbums(ctx, r.user, r.period, lastFMPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	plays := make(map[string]int, len(recent))
+	for _, album := range recent {
+		plays[albumKey(album.Artist.Name, album.Name)] = int(album.PlayCount)
+	}
+
+	values := make([]float64, len(albums))
+	for i, album := range albums {
+		values[i] = float64(plays[albumKey(album.Artist.Name, album.Name)])
+	}
+	return normalize(values), nil
+}
+
+// trackCoverageSignal favours albums of which many different tracks were played,
+// as opposed to a single track on repeat
+type trackCoverageSignal struct {
+	client *LastFMClient
+	user   string
+	period string
+}
+
+func (t *trackCoverageSignal) Name() string {
+	return "tracks"
+}
+
+func (t *trackCoverageSignal) Compute(ctx context.Context, albums []*Album) ([]float64, error) {
+	topTracks, err := t.client.GetTopTracks(ctx, t.user, t.period, scoreTopTrackLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	played := make(map[string]bool, len(topTracks))
+	for _, track := range topTracks {
+		played[albumKey(track.Artist.Name, track.Name)] = true
+	}
+
+	values := make([]float64, len(albums))
+	failed := 0
+	for i, album := range albums {
+		info, err := t.client.GetAlbumInfo(ctx, album.Artist.Name, album.Name, "")
+		if err != nil {
+			failed++
+			continue
+		}
+		if len(info.Tracks.Track) == 0 {
+			continue
+		}
+
+		count := 0
+		for _, track := range info.Tracks.Track {
+			if played[albumKey(album.Artist.Name, track.Name)] {
+				count++
+			}
+		}
+		values[i] = float64(count) / float64(len(info.Tracks.Track))
+	}
+
+	if failed > 0 {
+		return values, fmt.Errorf("track listing unavailable for %d albums", failed)
+	}
+	return values, nil
+}
+
+// artistPresenceSignal favours artists with many albums in the library; give it a
+// negative weight to favour under-represented artists instead
+type artistPresenceSignal struct {
+	client *SubsonicClient
+}
+
+func (a *artistPresenceSignal) Name() string {
+	return "artist"
+}
+
+func (a *artistPresenceSignal) Compute(ctx context.Context, albums []*Album) ([]float64, error) {
+	artists, err := a.client.GetArtists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(artists))
+	for _, artist := range artists {
+		counts[strings.ToLower(cleanString(artist.Name))] += artist.AlbumCount
+	}
+
+	values := make([]float64, len(albums))
+	for i, album := range albums {
+		values[i] = float64(counts[strings.ToLower(cleanString(album.Artist.Name))])
+	}
+	return normalize(values), nil
+}
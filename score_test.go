@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fixedSignal is a ScoreSignal returning predefined values
+type fixedSignal struct {
+	name   string
+	values []float64
+	err    error
+}
+
+func (f fixedSignal) Name() string {
+	return f.name
+}
+
+func (f fixedSignal) Compute(ctx context.Context, albums []*Album) ([]float64, error) {
+	return f.values, f.err
+}
+
+func scoreTestAlbums(names ...string) []*Album {
+	albums := make([]*Album, len(names))
+	for i, name := range names {
+		albums[i] = &Album{Name: name}
+		albums[i].Artist.Name = "Artist " + name
+	}
+	return albums
+}
+
+func albumNames(albums []*Album) string {
+	names := make([]string, len(albums))
+	for i, album := range albums {
+		names[i] = album.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestScorerOrdersByWeightedSum(t *testing.T) {
+	albums := scoreTestAlbums("A", "B", "C")
+
+	scorer := NewScorer().
+		Add(fixedSignal{name: "first", values: []float64{1, 0.5, 0}}, 1).
+		Add(fixedSignal{name: "second", values: []float64{0, 0.5, 1}}, 2).
+		Add(fixedSignal{name: "unused", values: []float64{100, 0, 0}}, 0)
+
+	if err := scorer.Score(context.Background(), albums); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := albumNames(albums); got != "C,B,A" {
+		t.Errorf("Expected order C,B,A, got %s", got)
+	}
+	if albums[0].Score != 2 || albums[1].Score != 1.5 || albums[2].Score != 1 {
+		t.Errorf("Unexpected scores: %v, %v, %v", albums[0].Score, albums[1].Score, albums[2].Score)
+	}
+}
+
+func TestScorerKeepsOrderForTies(t *testing.T) {
+	albums := scoreTestAlbums("A", "B", "C")
+
+	scorer := NewScorer().Add(fixedSignal{name: "flat", values: []float64{0.5, 1, 0.5}}, 1)
+	if err := scorer.Score(context.Background(), albums); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := albumNames(albums); got != "B,A,C" {
+		t.Errorf("Expected order B,A,C, got %s", got)
+	}
+}
+
+func TestScorerNegativeWeight(t *testing.T) {
+	albums := scoreTestAlbums("A", "B")
+
+	scorer := NewScorer().Add(fixedSignal{name: "artist", values: []float64{1, 0}}, -1)
+	if err := scorer.Score(context.Background(), albums); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := albumNames(albums); got != "B,A" {
+		t.Errorf("Expected order B,A, got %s", got)
+	}
+}
+
+func TestScorerSkipsFailingSignal(t *testing.T) {
+	albums := scoreTestAlbums("A", "B")
+
+	scorer := NewScorer().
+		Add(fixedSignal{name: "broken", err: errors.New("unavailable")}, 5).
+		Add(fixedSignal{name: "good", values: []float64{0, 1}}, 1)
+
+	err := scorer.Score(context.Background(), albums)
+	if err == nil || !strings.Contains(err.Error(), "broken signal: unavailable") {
+		t.Errorf("Expected error naming the broken signal, got: %v", err)
+	}
+	if got := albumNames(albums); got != "B,A" {
+		t.Errorf("Expected remaining signals to be applied, got order %s", got)
+	}
+}
+
+func TestScoreWeightsReorders(t *testing.T) {
+	tests := []struct {
+		weights  ScoreWeights
+		expected bool
+	}{
+		{ScoreWeights{PlayCount: 1}, false},
+		{ScoreWeights{PlayCount: 2}, false},
+		{ScoreWeights{PlayCount: -1}, true},
+		{ScoreWeights{PlayCount: 1, Recency: 0.5}, true},
+		{ScoreWeights{Artist: -1}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.weights.reorders(); got != tt.expected {
+			t.Errorf("%+v: expected reorders %v, got %v", tt.weights, tt.expected, got)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	values := normalize([]float64{2, 4, 0})
+	if values[0] != 0.5 || values[1] != 1 || values[2] != 0 {
+		t.Errorf("Unexpected normalized values: %v", values)
+	}
+
+	values = normalize([]float64{0, 0})
+	if values[0] != 0 || values[1] != 0 {
+		t.Errorf("Expected zeros to stay zero, got %v", values)
+	}
+}
+
+func TestRecencyPeriod(t *testing.T) {
+	tests := map[string]string{
+		"7day":    "7day",
+		"1month":  "7day",
+		"3month":  "1month",
+		"12month": "1month",
+		"overall": "1month",
+	}
+	for period, expected := range tests {
+		if got := recencyPeriod(period); got != expected {
+			t.Errorf("recencyPeriod(%s): expected %s, got %s", period, expected, got)
+		}
+	}
+}
+
+func TestPlayCountSignal(t *testing.T) {
+	albums := scoreTestAlbums("A", "B")
+	albums[0].PlayCount = 50
+	albums[1].PlayCount = 200
+
+	values, err := playCountSignal{}.Compute(context.Background(), albums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != 0.25 || values[1] != 1 {
+		t.Errorf("Unexpected play count values: %v", values)
+	}
+}
+
+// newScoreLastFMServer serves canned Last.fm responses keyed by the API method
+func newScoreLastFMServer(t *testing.T, responses map[string]func(r *http.Request) string) *LastFMClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond, ok := responses[r.URL.Query().Get("method")]
+		if !ok {
+			t.Errorf("Unexpected Last.fm method %s", r.URL.Query().Get("method"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(respond(r)))
+	}))
+	t.Cleanup(server.Close)
+
+	return &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: server.URL + "/"}
+}
+
+func TestRecencySignal(t *testing.T) {
+	client := newScoreLastFMServer(t, map[string]func(r *http.Request) string{
+		"user.gettopalbums": func(r *http.Request) string {
+			if r.URL.Query().Get("period") != "1month" {
+				t.Errorf("Expected recent period 1month, got %s", r.URL.Query().Get("period"))
+			}
+			return `{"topalbums":{"album":[
+				{"name":"B (Deluxe)","artist":{"name":"artist b"},"playcount":"40"},
+				{"name":"A","artist":{"name":"Artist A"},"playcount":"10"}
+			],"@attr":{"page":"1","totalPages":"1"}}}`
+		},
+	})
+
+	albums := scoreTestAlbums("A", "B", "C")
+	signal := &recencySignal{client: client, user: "testuser", period: recencyPeriod("12month")}
+	values, err := signal.Compute(context.Background(), albums)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values[0] != 0.25 || values[1] != 1 || values[2] != 0 {
+		t.Errorf("Unexpected recency values: %v", values)
+	}
+}
+
+func TestTrackCoverageSignal(t *testing.T) {
+	client := newScoreLastFMServer(t, map[string]func(r *http.Request) string{
+		"user.gettoptracks": func(r *http.Request) string {
+			return `{"toptracks":{"track":[
+				{"name":"One","artist":{"name":"Artist A"},"playcount":"9"},
+				{"name":"Two","artist":{"name":"Artist A"},"playcount":"3"},
+				{"name":"Solo","artist":{"name":"Artist B"},"playcount":"30"}
+			],"@attr":{"page":"1","totalPages":"1"}}}`
+		},
+		"album.getinfo": func(r *http.Request) string {
+			switch r.URL.Query().Get("album") {
+			case "A":
+				return `{"album":{"name":"A","tracks":{"track":[{"name":"One"},{"name":"Two"},{"name":"Three"},{"name":"Four"}]}}}`
+			case "B":
+				return `{"album":{"name":"B","tracks":{"track":{"name":"Solo"}}}}`
+			default:
+				return `{"error":6,"message":"Album not found"}`
+			}
+		},
+	})
+
+	albums := scoreTestAlbums("A", "B", "C")
+	signal := &trackCoverageSignal{client: client, user: "testuser", period: "12month"}
+	values, err := signal.Compute(context.Background(), albums)
+	if err == nil || !strings.Contains(err.Error(), "unavailable for 1 albums") {
+		t.Errorf("Expected error about the missing track listing, got: %v", err)
+	}
+
+	if values[0] != 0.5 || values[1] != 1 || values[2] != 0 {
+		t.Errorf("Unexpected track coverage values: %v", values)
+	}
+}
+
+func TestArtistPresenceSignal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/rest/getArtists.view") {
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","artists":{"index":[
+			{"name":"A","artist":[{"id":"1","name":"Artist A","albumCount":6}]},
+			{"name":"B","artist":[{"id":"2","name":"artist b","albumCount":2}]}
+		]}}}`))
+	}))
+	defer server.Close()
+
+	albums := scoreTestAlbums("A", "B", "C")
+	signal := &artistPresenceSignal{client: NewSubsonicClient(newHTTPClient(false), server.URL, "user", "pass")}
+	values, err := signal.Compute(context.Background(), albums)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values[0] != 1 || math.Abs(values[1]-1.0/3) > 1e-9 || values[2] != 0 {
+		t.Errorf("Unexpected artist presence values: %v", values)
+	}
+}
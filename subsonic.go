@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// searchPageSize is how many albums, artists or songs a search asks for at a time
+	searchPageSize = 50
+	// searchMaxPages is how many pages of albums or songs a search walks at most
+	searchMaxPages = 3
+	// searchAlbumLimit is the most albums or songs a search returns; a search returning as
+	// many is ambiguous, since the album looked for may be among those left out
+	searchAlbumLimit = searchPageSize * searchMaxPages
+)
+
+// SubsonicResponse represents the Subsonic API search response structure
+type SubsonicResponse struct {
+	SubsonicResponse struct {
+		SearchResult3 struct {
+			Album []SubsonicAlbum `json:"album"`
+		} `json:"searchResult3"`
+	} `json:"subsonic-response"`
+}
+
+// SubsonicArtistSearchResponse represents the artists of a Subsonic search response
+type SubsonicArtistSearchResponse struct {
+	SubsonicResponse struct {
+		SearchResult3 struct {
+			Artist []SubsonicArtist `json:"artist"`
+		} `json:"searchResult3"`
+	} `json:"subsonic-response"`
+}
+
+// SubsonicSongSearchResponse represents the songs of a Subsonic search response
+type SubsonicSongSearchResponse struct {
+	SubsonicResponse struct {
+		SearchResult3 struct {
+			Song []SubsonicSong `json:"song"`
+		} `json:"searchResult3"`
+	} `json:"subsonic-response"`
+}
+
+// SubsonicSong represents a song entry of the Subsonic library
+type SubsonicSong struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	Artist        string `json:"artist"`
+	Album         string `json:"album"`
+	MusicBrainzID string `json:"musicBrainzId"` // OpenSubsonic servers only
+}
+
+// SubsonicArtistResponse represents the Subsonic getArtist response structure
+type SubsonicArtistResponse struct {
+	SubsonicResponse struct {
+		Artist struct {
+			Album []SubsonicAlbum `json:"album"`
+		} `json:"artist"`
+	} `json:"subsonic-response"`
+}
+
+// SubsonicAlbumResponse represents the Subsonic getAlbum response structure
+type SubsonicAlbumResponse struct {
+	SubsonicResponse struct {
+		Album struct {
+			Song []struct {
+				ID string `json:"id"`
+			} `json:"song"`
+		} `json:"album"`
+	} `json:"subsonic-response"`
+}
+
+// subsonicStatus represents the status part shared by every Subsonic API response
+type subsonicStatus struct {
+	SubsonicResponse struct {
+		Status string `json:"status"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"subsonic-response"`
+}
+
+// SubsonicArtistsResponse represents the Subsonic getArtists response structure
+type SubsonicArtistsResponse struct {
+	SubsonicResponse struct {
+		Artists struct {
+			Index []struct {
+				Name   string           `json:"name"`
+				Artist []SubsonicArtist `json:"artist"`
+			} `json:"index"`
+		} `json:"artists"`
+	} `json:"subsonic-response"`
+}
+
+// SubsonicArtist represents an artist entry of the Subsonic library
+type SubsonicArtist struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	AlbumCount int    `json:"albumCount"`
+}
+
+// SubsonicClient handles all Subsonic API operations with authentication
+type SubsonicClient struct {
+	httpClient *HTTPClient
+	server     string
+	user       string
+	password   string
+	matcher    *Matcher // nil requires equal names
+}
+
+// NewSubsonicClient creates a new Subsonic API client
+func NewSubsonicClient(httpClient *HTTPClient, server, user, password string) *SubsonicClient {
+	return &SubsonicClient{
+		httpClient: httpClient,
+		server:     server,
+		user:       user,
+		password:   password,
+	}
+}
+
+// get calls a Subsonic API endpoint with token authentication and decodes the JSON response into v
+func (s *SubsonicClient) get(ctx context.Context, endpoint string, params url.Values, v any) error {
+	salt := time.Now().Format("20060102150405")
+	token := md5.Sum([]byte(s.password + salt))
+	tokenStr := hex.EncodeToString(token[:])
+
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("u", s.user)
+	params.Set("t", tokenStr)
+	params.Set("s", salt)
+	params.Set("v", "1.16.1")
+	params.Set("c", "albumcheck")
+	params.Set("f", "json")
+	requestURL := fmt.Sprintf("%s%s%s?%s", s.server, subsonicAPIPath, endpoint, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.httpClient.DoWithRetry(ctx, req)
+	if err != nil {
+		return fmt.Errorf("Subsonic API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Subsonic response body: %w", err)
+	}
+
+	var status subsonicStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("failed to unmarshal Subsonic response: %w", err)
+	}
+	if apiErr := status.SubsonicResponse.Error; status.SubsonicResponse.Status == "failed" && apiErr != nil {
+		return fmt.Errorf("Subsonic API error %d: %s", apiErr.Code, apiErr.Message)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to unmarshal Subsonic response: %w", err)
+	}
+	return nil
+}
+
+// SearchAlbum searches for albums in the Subsonic library by name, walking up to
+// searchMaxPages pages of results
+func (s *SubsonicClient) SearchAlbum(ctx context.Context, albumName string) ([]SubsonicAlbum, error) {
+	var albums []SubsonicAlbum
+	for page := range searchMaxPages {
+		params := url.Values{}
+		params.Set("query", cleanString(albumName))
+		params.Set("albumCount", strconv.Itoa(searchPageSize))
+		params.Set("albumOffset", strconv.Itoa(page*searchPageSize))
+		params.Set("artistCount", "0")
+		params.Set("songCount", "0")
+
+		var subsonicResp SubsonicResponse
+		if err := s.get(ctx, "search3.view", params, &subsonicResp); err != nil {
+			return nil, err
+		}
+
+		results := subsonicResp.SubsonicResponse.SearchResult3.Album
+		albums = append(albums, results...)
+		if len(results) < searchPageSize {
+			break
+		}
+	}
+	return albums, nil
+}
+
+// SearchSongs searches for songs in the Subsonic library by name, walking up to
+// searchMaxPages pages of results
+func (s *SubsonicClient) SearchSongs(ctx context.Context, query string) ([]SubsonicSong, error) {
+	var songs []SubsonicSong
+	for page := range searchMaxPages {
+		params := url.Values{}
+		params.Set("query", cleanString(query))
+		params.Set("songCount", strconv.Itoa(searchPageSize))
+		params.Set("songOffset", strconv.Itoa(page*searchPageSize))
+		params.Set("artistCount", "0")
+		params.Set("albumCount", "0")
+
+		var searchResp SubsonicSongSearchResponse
+		if err := s.get(ctx, "search3.view", params, &searchResp); err != nil {
+			return nil, err
+		}
+
+		results := searchResp.SubsonicResponse.SearchResult3.Song
+		songs = append(songs, results...)
+		if len(results) < searchPageSize {
+			break
+		}
+	}
+	return songs, nil
+}
+
+// SearchArtists searches for artists in the Subsonic library by name
+func (s *SubsonicClient) SearchArtists(ctx context.Context, artistName string) ([]SubsonicArtist, error) {
+	params := url.Values{}
+	params.Set("query", cleanString(artistName))
+	params.Set("artistCount", strconv.Itoa(searchPageSize))
+	params.Set("albumCount", "0")
+	params.Set("songCount", "0")
+
+	var searchResp SubsonicArtistSearchResponse
+	if err := s.get(ctx, "search3.view", params, &searchResp); err != nil {
+		return nil, err
+	}
+	return searchResp.SubsonicResponse.SearchResult3.Artist, nil
+}
+
+// GetArtist lists the albums of the library artist with the given ID
+func (s *SubsonicClient) GetArtist(ctx context.Context, id string) ([]SubsonicAlbum, error) {
+	params := url.Values{}
+	params.Set("id", id)
+
+	var artistResp SubsonicArtistResponse
+	if err := s.get(ctx, "getArtist.view", params, &artistResp); err != nil {
+		return nil, err
+	}
+	return artistResp.SubsonicResponse.Artist.Album, nil
+}
+
+// GetArtists lists every artist in the Subsonic library together with their album count
+func (s *SubsonicClient) GetArtists(ctx context.Context) ([]SubsonicArtist, error) {
+	var artistsResp SubsonicArtistsResponse
+	if err := s.get(ctx, "getArtists.view", nil, &artistsResp); err != nil {
+		return nil, err
+	}
+
+	var artists []SubsonicArtist
+	for _, index := range artistsResp.SubsonicResponse.Artists.Index {
+		artists = append(artists, index.Artist...)
+	}
+	return artists, nil
+}
+
+// CountAlbumSongs counts the songs of the library album with the given ID
+func (s *SubsonicClient) CountAlbumSongs(ctx context.Context, id string) (int, error) {
+	params := url.Values{}
+	params.Set("id", id)
+
+	var albumResp SubsonicAlbumResponse
+	if err := s.get(ctx, "getAlbum.view", params, &albumResp); err != nil {
+		return 0, err
+	}
+	return len(albumResp.SubsonicResponse.Album.Song), nil
+}
+
+// HasAlbum checks if a specific album exists in the Subsonic library
+func (s *SubsonicClient) HasAlbum(ctx context.Context, album Album) (bool, error) {
+	match, err := s.MatchAlbum(ctx, album)
+	return match.Owned, err
+}
+
+// MatchAlbum searches the Subsonic library for the album, matching the results by
+// MusicBrainz ID where the server provides them and by name otherwise
+func (s *SubsonicClient) MatchAlbum(ctx context.Context, album Album) (AlbumMatch, error) {
+	_, match, err := s.searchLibrary(ctx, album)
+	return match, err
+}
+
+// HasTrack searches the Subsonic library for a single track, matching the songs found by
+// MusicBrainz recording ID where the server provides them and by name otherwise. Like
+// album searches, an ambiguous search for the title is narrowed down to the artist.
+func (s *SubsonicClient) HasTrack(ctx context.Context, track Track) (bool, error) {
+	song := Album{Name: track.Name, MBID: track.MBID}
+	song.Artist.Name = track.Artist.Name
+
+	title := cleanString(s.matcher.normalizer().StripEdition(track.Name))
+	for _, query := range []string{title, cleanString(track.Artist.Name + " " + title)} {
+		songs, err := s.SearchSongs(ctx, query)
+		if err != nil {
+			return false, err
+		}
+		if s.matcher.Match(song, songCandidates(songs)).Owned {
+			return true, nil
+		}
+		if len(songs) < searchAlbumLimit {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// librarySearch is one request made to look an album up, with the albums it returned
+type librarySearch struct {
+	Method string // search3 or getArtist
+	Query  string // searched text, or the name of the artist listed
+	Albums []SubsonicAlbum
+}
+
+// searchLibrary looks the album up step by step until it is found. It searches for the title
+// first. Only when that search is ambiguous, returning as many albums as a search can, as for
+// "Greatest Hits" or "Live", it goes on to search for artist and title together, which servers
+// with full-text search narrow down to the artist, and then lists every album of the library
+// artists with the name of the album's artist or one of its aliases.
+func (s *SubsonicClient) searchLibrary(ctx context.Context, album Album) (searches []librarySearch, match AlbumMatch, err error) {
+	try := func(method, query string, albums []SubsonicAlbum) bool {
+		searches = append(searches, librarySearch{Method: method, Query: query, Albums: albums})
+		match = s.matcher.Match(album, searchCandidates(albums))
+		return match.Owned
+	}
+
+	title := cleanString(s.matcher.normalizer().StripEdition(album.Name))
+	albums, err := s.SearchAlbum(ctx, title)
+	if err != nil {
+		return searches, match, err
+	}
+	if try("search3", title, albums) || len(albums) < searchAlbumLimit {
+		return searches, match, nil
+	}
+
+	query := cleanString(album.Artist.Name + " " + title)
+	if albums, err = s.SearchAlbum(ctx, query); err != nil {
+		return searches, match, err
+	}
+	if try("search3", query, albums) {
+		return searches, match, nil
+	}
+
+	names := s.matcher.artistNames(album.Artist.Name)
+	listed := map[string]bool{}
+	for _, name := range s.matcher.searchNames(album.Artist.Name) {
+		artists, err := s.SearchArtists(ctx, name)
+		if err != nil {
+			return searches, match, err
+		}
+		for _, artist := range artists {
+			if listed[artist.ID] || artistSimilarity(names, s.matcher.normalizer().Artist(artist.Name)) < s.matcher.threshold() {
+				continue
+			}
+			listed[artist.ID] = true
+
+			if albums, err = s.GetArtist(ctx, artist.ID); err != nil {
+				return searches, match, err
+			}
+			for i := range albums {
+				if albums[i].Artist == "" {
+					albums[i].Artist = artist.Name
+				}
+			}
+			if try("getArtist", artist.Name, albums) {
+				return searches, match, nil
+			}
+		}
+	}
+	return searches, match, nil
+}
+
+// songCandidates turns song search results into match candidates
+func songCandidates(songs []SubsonicSong) []matchCandidate {
+	candidates := make([]matchCandidate, len(songs))
+	for i, song := range songs {
+		candidates[i] = matchCandidate{Artist: song.Artist, Title: song.Title, MBID: song.MusicBrainzID, ID: song.ID}
+	}
+	return candidates
+}
+
+// searchCandidates turns search results into match candidates
+func searchCandidates(albums []SubsonicAlbum) []matchCandidate {
+	candidates := make([]matchCandidate, len(albums))
+	for i, a := range albums {
+		candidates[i] = matchCandidate{Artist: a.Artist, Title: a.Title, MBID: a.MusicBrainzID, ID: a.ID, Songs: a.SongCount}
+	}
+	return candidates
+}
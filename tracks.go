@@ -0,0 +1,276 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// TrackChecker looks single tracks up in the library
+type TrackChecker interface {
+	HasTrack(ctx context.Context, track Track) (bool, error)
+}
+
+// MissingTrack is a top track missing from the library
+type MissingTrack struct {
+	Name      string `json:"name"`
+	Rank      int    `json:"rank"`
+	PlayCount int    `json:"playcount"`
+}
+
+// TrackAlbum is an album recommended for the missing top tracks on it. The album's play
+// count is that of the missing tracks, its rank the best rank among them and its score
+// the share of all missing plays it covers.
+type TrackAlbum struct {
+	Album  Album
+	Tracks []MissingTrack // in Last.fm order
+}
+
+// TrackResult summarises a run of top tracks checked against the library
+type TrackResult struct {
+	Tracks  int           // top tracks checked
+	Missing int           // top tracks missing from the library
+	Plays   int           // plays of the missing tracks
+	NoAlbum int           // missing tracks Last.fm knows no album of
+	Owned   int           // albums of missing tracks that are in the library after all
+	Ignored int           // albums of missing tracks left out by the ignore file
+	Snoozed int           // albums of missing tracks held back by an active snooze
+	Albums  []*TrackAlbum // the albums covering the most missing plays first
+	Stats   ErrorStats
+}
+
+// findTrackAlbums checks the top tracks against the library, looks up the album of every
+// missing track on Last.fm and recommends up to limit albums by how many plays of missing
+// tracks they cover; a limit of 0 recommends every album. Albums that albumChecker finds
+// in the library are passed over, since their tracks are most likely there under another
+// name.
+func findTrackAlbums(ctx context.Context, trackChecker TrackChecker, albumChecker AlbumChecker, lastFM *LastFMClient, tracks []Track, cfg *Config, limit int) (*TrackResult, error) {
+	result := &TrackResult{Tracks: len(tracks)}
+	missing, err := findMissingTracks(ctx, trackChecker, tracks, cfg, result)
+	if err != nil {
+		return nil, err
+	}
+	albums, err := groupTracksByAlbum(ctx, lastFM, missing, cfg, result)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreList := loadIgnoreList(cfg.IgnoreFile)
+	for _, album := range albums {
+		if limit > 0 && len(result.Albums) >= limit {
+			break
+		}
+		if rule := ignoreList.Match(album.Album); rule != nil {
+			if rule.Snoozed() {
+				result.Snoozed++
+			} else {
+				result.Ignored++
+			}
+			continue
+		}
+
+		result.Stats.Total++
+		owned, err := albumChecker.HasAlbum(ctx, album.Album)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			result.Stats.Failed++
+			categorizeError(err, &result.Stats)
+			if cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "\nError checking album '%s - %s': %v\n", album.Album.Artist.Name, album.Album.Name, err)
+			}
+			continue
+		}
+		result.Stats.Successful++
+		if owned {
+			result.Owned++
+			if cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "\nPassing over '%s - %s', which is in the library\n", album.Album.Artist.Name, album.Album.Name)
+			}
+			continue
+		}
+		result.Albums = append(result.Albums, album)
+	}
+	return result, nil
+}
+
+// findMissingTracks checks the tracks against the library with up to cfg.Workers
+// concurrent lookups, returning the missing ones in Last.fm order
+func findMissingTracks(ctx context.Context, checker TrackChecker, tracks []Track, cfg *Config, result *TrackResult) ([]Track, error) {
+	progress := NewProgressBar("Checking tracks in library...", len(tracks))
+	progress.Start()
+	defer progress.Stop()
+
+	owned := make([]bool, len(tracks))
+	errs := make([]error, len(tracks))
+	var checked atomic.Int64
+	forEachConcurrently(ctx, len(tracks), cfg.Workers, func(i int) {
+		owned[i], errs[i] = checker.HasTrack(ctx, tracks[i])
+		progress.Update(int(checked.Add(1)))
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var missing []Track
+	for i, track := range tracks {
+		result.Stats.Total++
+		if errs[i] != nil {
+			result.Stats.Failed++
+			categorizeError(errs[i], &result.Stats)
+			if cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "\nError checking track '%s - %s': %v\n", track.Artist.Name, track.Name, errs[i])
+			}
+			continue
+		}
+		result.Stats.Successful++
+		if !owned[i] {
+			missing = append(missing, track)
+		}
+	}
+	result.Missing = len(missing)
+	return missing, nil
+}
+
+// groupTracksByAlbum looks up the album of every missing track on Last.fm with up to
+// cfg.Workers concurrent lookups and groups the tracks by album, the albums covering the
+// most plays first and, among albums covering as many, the album with the best ranked
+// track first
+func groupTracksByAlbum(ctx context.Context, lastFM *LastFMClient, missing []Track, cfg *Config, result *TrackResult) ([]*TrackAlbum, error) {
+	progress := NewProgressBar("Finding albums of missing tracks...", len(missing))
+	progress.Start()
+	defer progress.Stop()
+
+	infos := make([]*TrackInfo, len(missing))
+	errs := make([]error, len(missing))
+	var looked atomic.Int64
+	forEachConcurrently(ctx, len(missing), cfg.Workers, func(i int) {
+		infos[i], errs[i] = lastFM.GetTrackInfo(ctx, missing[i].Artist.Name, missing[i].Name)
+		progress.Update(int(looked.Add(1)))
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	byKey := map[string]*TrackAlbum{}
+	var albums []*TrackAlbum
+	for i, track := range missing {
+		result.Plays += int(track.PlayCount)
+
+		info, err := infos[i], errs[i]
+		if err != nil && cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "\nError finding the album of '%s - %s': %v\n", track.Artist.Name, track.Name, err)
+		}
+		if err != nil || info.Album.Title == "" {
+			result.NoAlbum++
+			continue
+		}
+
+		artist := cmp.Or(info.Album.Artist, track.Artist.Name)
+		key := albumKey(artist, info.Album.Title)
+		album := byKey[key]
+		if album == nil {
+			album = &TrackAlbum{Album: Album{Name: info.Album.Title, URL: info.Album.URL, MBID: info.Album.MBID, Image: info.Album.Image}}
+			album.Album.Artist.Name = artist
+			album.Album.Attr.Rank = track.Attr.Rank
+			byKey[key] = album
+			albums = append(albums, album)
+		}
+		album.Album.PlayCount += track.PlayCount
+		album.Tracks = append(album.Tracks, MissingTrack{Name: track.Name, Rank: int(track.Attr.Rank), PlayCount: int(track.PlayCount)})
+	}
+
+	for _, album := range albums {
+		if result.Plays > 0 {
+			album.Album.Score = float64(album.Album.PlayCount) / float64(result.Plays)
+		}
+	}
+	// Albums are in the order of their best ranked track, which the stable sort keeps for ties
+	slices.SortStableFunc(albums, func(a, b *TrackAlbum) int {
+		return cmp.Compare(b.Album.PlayCount, a.Album.PlayCount)
+	})
+	return albums, nil
+}
+
+// newTrackReport builds the report for a finished run of the tracks command
+func newTrackReport(cfg *Config, result *TrackResult) *Report {
+	report := &Report{
+		Version:         reportVersion,
+		GeneratedAt:     time.Now().UTC(),
+		User:            cfg.LastFMUser,
+		Period:          cfg.LastFMPeriod,
+		Recommendations: make([]Recommendation, 0, len(result.Albums)),
+		Ignored:         result.Ignored,
+		Snoozed:         result.Snoozed,
+		Stats:           result.Stats,
+	}
+
+	for _, album := range result.Albums {
+		rec := newRecommendation(&album.Album)
+		rec.MissingTracks = album.Tracks
+		report.Recommendations = append(report.Recommendations, rec)
+	}
+	return report
+}
+
+// printTrackAlbums displays the albums recommended for the missing top tracks, with the
+// missing tracks on each
+func printTrackAlbums(out io.Writer, result *TrackResult, period string) error {
+	printErrorStats(out, result.Stats)
+
+	if result.Missing == 0 {
+		fmt.Fprintf(out, "All top tracks (%s) exist in your Subsonic library!\n", lastFMPeriods[period])
+		return nil
+	}
+	fmt.Fprintf(out, "%d of %d top tracks (%s) are missing from your Subsonic library, played %s\n\n",
+		result.Missing, result.Tracks, lastFMPeriods[period], playCountText(result.Plays))
+
+	if len(result.Albums) == 0 {
+		fmt.Fprintln(out, "No album to recommend for the missing tracks")
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ALBUMS WITH YOUR MISSING TOP TRACKS (%s)\t\n", lastFMPeriods[period])
+		fmt.Fprintln(w, strings.Repeat("=", 80))
+		for i, album := range result.Albums {
+			fmt.Fprintf(w, "%d. %s - %s\n", i+1, album.Album.Artist.Name, album.Album.Name)
+			fmt.Fprintf(w, "   Covers:\t%s played %s (%.0f%% of missing plays)\n",
+				trackCountText(len(album.Tracks)), playCountText(int(album.Album.PlayCount)), album.Album.Score*100)
+			for _, track := range album.Tracks {
+				fmt.Fprintf(w, "   \t%s, played %s (#%d in your top tracks)\n", track.Name, playCountText(track.PlayCount), track.Rank)
+			}
+			fmt.Fprintf(w, "   Last.fm URL:\t%s\n", album.Album.URL)
+			fmt.Fprintln(w, strings.Repeat("-", 80))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if result.NoAlbum > 0 {
+		fmt.Fprintf(out, "\nLast.fm knows no album of %s\n", trackCountText(result.NoAlbum))
+	}
+	if result.Owned > 0 {
+		fmt.Fprintf(out, "\nAlbums passed over as in the library: %d\n", result.Owned)
+	}
+	if result.Ignored > 0 {
+		fmt.Fprintf(out, "\nAlbums left out by the ignore file: %d\n", result.Ignored)
+	}
+	printSnoozed(out, result.Snoozed)
+	return nil
+}
+
+// trackCountText describes a number of missing tracks
+func trackCountText(count int) string {
+	if count == 1 {
+		return "1 missing track"
+	}
+	return fmt.Sprintf("%d missing tracks", count)
+}
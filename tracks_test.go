@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTrackChecker owns the tracks it maps to true
+type fakeTrackChecker map[string]bool
+
+func (f fakeTrackChecker) HasTrack(ctx context.Context, track Track) (bool, error) {
+	if track.Name == "Broken" {
+		return false, fmt.Errorf("Subsonic API request failed: 503 service unavailable")
+	}
+	return f[track.Name], nil
+}
+
+// newTrackInfoServer serves the Last.fm album of every track in albums, and no album for other tracks
+func newTrackInfoServer(t *testing.T, albums map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("method") != "track.getinfo" {
+			t.Errorf("Unexpected Last.fm method %s", query.Get("method"))
+		}
+		album, ok := albums[query.Get("track")]
+		if !ok {
+			fmt.Fprintf(w, `{"track":{"name":%q,"artist":{"name":%q}}}`, query.Get("track"), query.Get("artist"))
+			return
+		}
+		fmt.Fprintf(w, `{"track":{"name":%q,"artist":{"name":%q},"album":{"artist":%q,"title":%q,"url":"https://www.last.fm/music/x"}}}`,
+			query.Get("track"), query.Get("artist"), query.Get("artist"), album)
+	}))
+}
+
+func TestSubsonicClientHasTrack(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("songCount") != "50" || query.Get("albumCount") != "0" {
+			t.Errorf("Expected a song search, got %s", r.URL.RawQuery)
+		}
+		queries = append(queries, query.Get("query")+" "+query.Get("songOffset"))
+
+		var resp SubsonicSongSearchResponse
+		switch query.Get("query") {
+		case "Intro":
+			// As many songs as a search returns, none of them by the artist
+			for i := range searchPageSize {
+				resp.SubsonicResponse.SearchResult3.Song = append(resp.SubsonicResponse.SearchResult3.Song,
+					SubsonicSong{Title: "Intro", Artist: fmt.Sprintf("Artist %s-%d", query.Get("songOffset"), i)})
+			}
+		case "The xx Intro":
+			resp.SubsonicResponse.SearchResult3.Song = []SubsonicSong{{Title: "Intro", Artist: "The xx"}}
+		case "Pull Me Under":
+			resp.SubsonicResponse.SearchResult3.Song = []SubsonicSong{{Title: "Pull Me Under (2023 Remaster)", Artist: "Dream Theater"}}
+		case "Yellow":
+			resp.SubsonicResponse.SearchResult3.Song = []SubsonicSong{{Title: "Yellow", Artist: "Coldplay", MusicBrainzID: "rec-1"}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+	client := NewSubsonicClient(newHTTPClient(false), server.URL, "u", "p")
+
+	byMBID := testTrack("Coldplay (Live)", "Yellow", 0)
+	byMBID.MBID = "REC-1"
+	tests := []struct {
+		track Track
+		owned bool
+	}{
+		{testTrack("Dream Theater", "Pull Me Under", 0), true},
+		{byMBID, true},
+		{testTrack("The xx", "Intro", 0), true},
+		{testTrack("Metallica", "One", 0), false},
+	}
+	for _, tt := range tests {
+		owned, err := client.HasTrack(context.Background(), tt.track)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owned != tt.owned {
+			t.Errorf("%s - %s: expected owned %v, got %v", tt.track.Artist.Name, tt.track.Name, tt.owned, owned)
+		}
+	}
+
+	expected := "Pull Me Under 0,Yellow 0,Intro 0,Intro 50,Intro 100,The xx Intro 0,One 0"
+	if got := strings.Join(queries, ","); got != expected {
+		t.Errorf("Expected searches %s, got %s", expected, got)
+	}
+}
+
+func TestFindTrackAlbums(t *testing.T) {
+	lastFM := newTrackInfoServer(t, map[string]string{
+		"Single A": "Singles",
+		"Deep Cut": "Album",
+		"Hit":      "Album",
+		"Other":    "Owned Album",
+		"Rare":     "B-Sides",
+	})
+	defer lastFM.Close()
+	lastFMClient := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: lastFM.URL + "/"}
+
+	tracks := []Track{
+		testTrack("Artist", "Owned Track", 100),
+		testTrack("Artist", "Other", 90),
+		testTrack("Artist", "Single A", 60),
+		testTrack("Artist", "Hit", 50),
+		testTrack("Artist", "Deep Cut", 30),
+		testTrack("Artist", "Broken", 20),
+		testTrack("Artist", "No Album", 10),
+		testTrack("Artist", "Rare", 10),
+	}
+	for i := range tracks {
+		tracks[i].Attr.Rank = flexInt(i + 1)
+	}
+	library := fakeTrackChecker{"Owned Track": true}
+	albums := &fakeChecker{owned: map[string]bool{"Owned Album": true}}
+
+	result, err := findTrackAlbums(context.Background(), library, albums, lastFMClient, tracks, &Config{Workers: 3}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Tracks != 8 || result.Missing != 6 || result.Plays != 250 || result.NoAlbum != 1 || result.Owned != 1 {
+		t.Errorf("Unexpected counts %+v", result)
+	}
+	if result.Stats.Failed != 1 || result.Stats.ServerError != 1 {
+		t.Errorf("Expected the failed track lookup to be counted, got %+v", result.Stats)
+	}
+	if len(result.Albums) != 2 {
+		t.Fatalf("Expected 2 albums, got %d", len(result.Albums))
+	}
+
+	// Owned Album covers 90 plays but is passed over, Album covers 80 and Singles 60; B-Sides is beyond the limit
+	album := result.Albums[0]
+	if album.Album.Name != "Album" || album.Album.PlayCount != 80 || album.Album.Attr.Rank != 4 || album.Album.Score != 0.32 {
+		t.Errorf("Unexpected first album %+v", album.Album)
+	}
+	if len(album.Tracks) != 2 || album.Tracks[0].Name != "Hit" || album.Tracks[1].Name != "Deep Cut" {
+		t.Errorf("Expected the missing tracks in Last.fm order, got %+v", album.Tracks)
+	}
+	if result.Albums[1].Album.Name != "Singles" {
+		t.Errorf("Expected Singles second, got %s", result.Albums[1].Album.Name)
+	}
+
+	report := newTrackReport(&Config{LastFMPeriod: "12month"}, result)
+	if rec := report.Recommendations[0]; rec.PlayCount != 80 || len(rec.MissingTracks) != 2 || rec.MissingTracks[1].PlayCount != 30 {
+		t.Errorf("Unexpected recommendation %+v", rec)
+	}
+}
+
+func TestGroupTracksByAlbumConcurrent(t *testing.T) {
+	var inFlight, most atomic.Int64
+	lastFM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		// Every track is on the album named after its first letter
+		track := r.URL.Query().Get("track")
+		fmt.Fprintf(w, `{"track":{"name":%q,"album":{"artist":"Artist","title":%q}}}`, track, track[:1])
+	}))
+	defer lastFM.Close()
+	lastFMClient := &LastFMClient{httpClient: newHTTPClient(false), apiKey: "test-key", baseURL: lastFM.URL + "/"}
+
+	var missing []Track
+	for i, name := range []string{"A1", "B1", "A2", "B2", "A3", "C1"} {
+		track := testTrack("Artist", name, 10)
+		track.Attr.Rank = flexInt(i + 1)
+		missing = append(missing, track)
+	}
+
+	albums, err := groupTracksByAlbum(context.Background(), lastFMClient, missing, &Config{Workers: 3}, &TrackResult{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most.Load() < 2 {
+		t.Errorf("Expected concurrent track.getInfo requests, got at most %d at a time", most.Load())
+	}
+	var got []string
+	for _, album := range albums {
+		for _, track := range album.Tracks {
+			got = append(got, track.Name)
+		}
+	}
+	if strings.Join(got, ",") != "A1,A2,A3,B1,B2,C1" {
+		t.Errorf("Expected albums by plays and tracks in Last.fm order, got %v", got)
+	}
+}
+
+func TestPrintTrackAlbums(t *testing.T) {
+	album := &TrackAlbum{
+		Album:  testAlbum("Dream Theater", "Images and Words"),
+		Tracks: []MissingTrack{{Name: "Pull Me Under", Rank: 2, PlayCount: 40}, {Name: "Metropolis", Rank: 9, PlayCount: 1}},
+	}
+	album.Album.PlayCount, album.Album.Score = 41, 0.82
+	result := &TrackResult{Tracks: 10, Missing: 3, Plays: 50, NoAlbum: 1, Albums: []*TrackAlbum{album}}
+
+	var out bytes.Buffer
+	if err := printTrackAlbums(&out, result, "12month"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"3 of 10 top tracks (last 12 months) are missing from your Subsonic library, played 50 times",
+		"1. Dream Theater - Images and Words",
+		"Covers:       2 missing tracks played 41 times (82% of missing plays)",
+		"Pull Me Under, played 40 times (#2 in your top tracks)",
+		"Metropolis, played once (#9 in your top tracks)",
+		"Last.fm knows no album of 1 missing track",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	printTrackAlbums(&out, &TrackResult{Tracks: 10}, "7day")
+	if !strings.Contains(out.String(), "All top tracks (last 7 days) exist in your Subsonic library!") {
+		t.Errorf("Unexpected output without missing tracks:\n%s", out.String())
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// triageBatchSize is how many missing albums are looked for whenever triage runs out of candidates
+	triageBatchSize = 5
+	// triageSnoozeMonths is how long the snooze key holds an album back
+	triageSnoozeMonths = 3
+)
+
+// triagePrompt lists the keys of interactive triage
+const triagePrompt = "[b]uy later, [i]gnore forever, [s]nooze 3 months, [o]pen in browser, [n]ext, [q]uit: "
+
+// triageSession walks through missing albums one by one, asking what to do with each.
+// Every decision is saved as soon as it is taken.
+type triageSession struct {
+	keys       *keyReader
+	out        io.Writer
+	next       func(ctx context.Context) (*Album, error) // nil once there are no more albums
+	history    *History
+	ignoreFile string
+	now        func() time.Time
+	open       func(url string) error
+
+	counts map[string]int
+}
+
+// run triages albums until they run out or the user quits
+func (t *triageSession) run(ctx context.Context) error {
+	t.counts = map[string]int{}
+
+	for n := 1; ; n++ {
+		album, err := t.next(ctx)
+		if err != nil {
+			return err
+		}
+		if album == nil {
+			fmt.Fprintln(t.out, "\nNo more missing albums.")
+			break
+		}
+
+		t.show(n, album)
+		quit, err := t.decide(album)
+		if err != nil {
+			return err
+		}
+		if quit {
+			break
+		}
+	}
+
+	fmt.Fprintf(t.out, "\nBuy later: %d, ignored: %d, snoozed: %d, skipped: %d\n",
+		t.counts[decisionBuyLater], t.counts[decisionIgnore], t.counts[decisionSnooze], t.counts[decisionSkip])
+	return nil
+}
+
+// show prints an album card
+func (t *triageSession) show(n int, album *Album) {
+	fmt.Fprintf(t.out, "\n%d. %s - %s\n", n, album.Artist.Name, album.Name)
+	if album.PlayCount > 0 {
+		fmt.Fprintf(t.out, "   Played:   %s (#%d in your top albums)\n", playCountText(int(album.PlayCount)), album.Attr.Rank)
+	}
+	fmt.Fprintf(t.out, "   Last.fm:  %s\n", album.URL)
+	if last := t.history.LastDecision(album.Artist.Name, album.Name); last != nil {
+		fmt.Fprintf(t.out, "   Earlier:  %s on %s\n", last.Decision, last.Time.Local().Format(time.DateOnly))
+	}
+}
+
+// decide prompts until a decision about the album has been taken and saved
+func (t *triageSession) decide(album *Album) (quit bool, err error) {
+	for {
+		fmt.Fprint(t.out, triagePrompt)
+		key, err := t.keys.read()
+		if err == io.EOF {
+			fmt.Fprintln(t.out)
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch key {
+		case "b":
+			return false, t.record(album, decisionBuyLater)
+		case "i":
+			if err := t.ignore(album, time.Time{}); err != nil {
+				fmt.Fprintf(t.out, "Cannot ignore: %v\n", err)
+				continue
+			}
+			return false, t.record(album, decisionIgnore)
+		case "s":
+			until := t.now().AddDate(0, triageSnoozeMonths, 0)
+			if err := t.ignore(album, until); err != nil {
+				fmt.Fprintf(t.out, "Cannot snooze: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(t.out, "Snoozed until %s\n", until.Format(time.DateOnly))
+			return false, t.record(album, decisionSnooze)
+		case "o":
+			if err := t.open(album.URL); err != nil {
+				fmt.Fprintf(t.out, "Cannot open %s: %v\n", album.URL, err)
+			}
+		case "n", "":
+			return false, t.record(album, decisionSkip)
+		case "q":
+			return true, nil
+		default:
+			fmt.Fprintln(t.out, "Unknown key")
+		}
+	}
+}
+
+// keyReader reads the answers of triage: a single key press when the input is a terminal,
+// which is switched to raw mode while waiting for the key, or else a line, so that answers
+// can also be piped in
+type keyReader struct {
+	in  *bufio.Reader
+	out io.Writer // echoes the keys pressed
+	fd  int       // file descriptor of the terminal, -1 for line input
+}
+
+// newKeyReader creates a key reader for f, reading single keys if f is a terminal
+func newKeyReader(f *os.File, out io.Writer) *keyReader {
+	fd := -1
+	if term.IsTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return &keyReader{in: bufio.NewReader(f), out: out, fd: fd}
+}
+
+// read returns the next answer in lower case, empty for Enter, and io.EOF once the input
+// ends. In raw mode Ctrl-C and Ctrl-D arrive as keys and end the input as well.
+func (r *keyReader) read() (string, error) {
+	if r.fd >= 0 {
+		if state, err := term.MakeRaw(r.fd); err == nil {
+			key, _, err := r.in.ReadRune()
+			term.Restore(r.fd, state)
+			if err != nil {
+				return "", err
+			}
+			if key == 3 || key == 4 {
+				return "", io.EOF
+			}
+			answer := strings.ToLower(strings.TrimSpace(string(key)))
+			fmt.Fprintln(r.out, answer)
+			return answer, nil
+		}
+	}
+
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.ToLower(strings.TrimSpace(line)), err
+}
+
+// ignore appends a rule for the album's Last.fm URL to the ignore file, snoozed until the given date unless it is zero
+func (t *triageSession) ignore(album *Album, until time.Time) error {
+	if t.ignoreFile == "" {
+		return fmt.Errorf("no ignore file configured (set IGNORE_FILE or --ignore-file)")
+	}
+	if album.URL == "" {
+		return fmt.Errorf("album has no Last.fm URL")
+	}
+
+	rule := IgnoreRule{Kind: ignoreURL, Value: album.URL}
+	if !until.IsZero() {
+		rule.SnoozeUntil = time.Date(until.Year(), until.Month(), until.Day(), 0, 0, 0, 0, time.Local)
+	}
+	return editIgnoreFile(t.ignoreFile, func(lines []string) []string {
+		return append(lines, rule.String())
+	})
+}
+
+// record adds the decision to the history and saves it
+func (t *triageSession) record(album *Album, decision string) error {
+	t.counts[decision]++
+	t.history.Decide(TriageDecision{
+		Time:     t.now().UTC(),
+		Artist:   album.Artist.Name,
+		Album:    album.Name,
+		URL:      album.URL,
+		Decision: decision,
+	})
+	return t.history.Save()
+}
+
+// openURL opens url in the default browser
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
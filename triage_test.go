@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestTriageSession returns a session over albums answering with the given input
+func newTestTriageSession(t *testing.T, input string, albums ...Album) (*triageSession, *bytes.Buffer) {
+	t.Helper()
+	dir := t.TempDir()
+	history, err := LoadHistory(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	session := &triageSession{
+		keys:       &keyReader{in: bufio.NewReader(strings.NewReader(input)), fd: -1},
+		out:        &out,
+		history:    history,
+		ignoreFile: filepath.Join(dir, "ignore"),
+		now:        func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local) },
+		open:       func(url string) error { return nil },
+		next: func(ctx context.Context) (*Album, error) {
+			if len(albums) == 0 {
+				return nil, nil
+			}
+			album := albums[0]
+			albums = albums[1:]
+			return &album, nil
+		},
+	}
+	return session, &out
+}
+
+func TestTriageSession(t *testing.T) {
+	var albums []Album
+	for _, name := range []string{"Keep", "Never", "Later", "Whatever"} {
+		album := testAlbum("A", name)
+		album.URL = "https://www.last.fm/music/A/" + name
+		albums = append(albums, album)
+	}
+	var opened []string
+	session, out := newTestTriageSession(t, "b\ni\nx\no\ns\n\n", albums...)
+	session.open = func(url string) error {
+		opened = append(opened, url)
+		return nil
+	}
+
+	if err := session.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(session.ignoreFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "https://www.last.fm/music/A/Never\nhttps://www.last.fm/music/A/Later snooze-until=2025-09-01\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected ignore file:\n%s", content)
+	}
+
+	if len(opened) != 1 || opened[0] != "https://www.last.fm/music/A/Later" {
+		t.Errorf("Expected the third album to be opened, got %v", opened)
+	}
+
+	history, err := LoadHistory(session.history.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decisions []string
+	for _, d := range history.Decisions {
+		decisions = append(decisions, d.Album+"="+d.Decision)
+	}
+	if got := strings.Join(decisions, " "); got != "Keep=buy-later Never=ignore Later=snooze Whatever=skip" {
+		t.Errorf("Unexpected saved decisions: %s", got)
+	}
+
+	output := out.String()
+	for _, want := range []string{"Unknown key", "Snoozed until 2025-09-01", "No more missing albums.", "Buy later: 1, ignored: 1, snoozed: 1, skipped: 1"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestTriageSessionQuit(t *testing.T) {
+	fetched := 0
+	session, out := newTestTriageSession(t, "b\nq\n")
+	session.next = func(ctx context.Context) (*Album, error) {
+		fetched++
+		album := testAlbum("A", "Endless")
+		return &album, nil
+	}
+	session.history.Decide(TriageDecision{Time: time.Date(2025, 1, 2, 12, 0, 0, 0, time.Local), Artist: "a", Album: "endless", Decision: decisionSkip})
+
+	if err := session.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fetched != 2 {
+		t.Errorf("Expected quitting to stop fetching albums, fetched %d", fetched)
+	}
+	if !strings.Contains(out.String(), "Earlier:  skip on 2025-01-02") {
+		t.Errorf("Expected the earlier decision to be shown, got:\n%s", out.String())
+	}
+	if len(session.history.Decisions) != 2 {
+		t.Errorf("Expected only the buy later decision to be added, got %+v", session.history.Decisions)
+	}
+}
+
+func TestTriageSessionEndOfInput(t *testing.T) {
+	session, out := newTestTriageSession(t, "", testAlbum("A", "B"))
+	if err := session.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "skipped: 0") || len(session.history.Decisions) != 0 {
+		t.Errorf("Expected end of input to quit without decisions, got:\n%s", out.String())
+	}
+}
+
+func TestTriageSessionWithoutIgnoreFile(t *testing.T) {
+	session, out := newTestTriageSession(t, "i\ns\nb\n", testAlbum("A", "B"))
+	session.ignoreFile = ""
+
+	if err := session.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out.String(), "no ignore file configured") != 2 {
+		t.Errorf("Expected ignore and snooze to be refused, got:\n%s", out.String())
+	}
+	if len(session.history.Decisions) != 1 || session.history.Decisions[0].Decision != decisionBuyLater {
+		t.Errorf("Expected the album to be marked buy later after the refusals, got %+v", session.history.Decisions)
+	}
+}
+
+func TestTriageSessionFetchError(t *testing.T) {
+	session, _ := newTestTriageSession(t, "")
+	fetchErr := errors.New("boom")
+	session.next = func(ctx context.Context) (*Album, error) { return nil, fetchErr }
+
+	if err := session.run(context.Background()); !errors.Is(err, fetchErr) {
+		t.Errorf("Expected the fetch error, got %v", err)
+	}
+}
+
+func TestKeyReaderReadsLinesWithoutTerminal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answers")
+	if err := os.WriteFile(path, []byte(" B \n\nq"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	keys := newKeyReader(f, io.Discard)
+	if keys.fd != -1 {
+		t.Fatal("Expected a file to be read line by line")
+	}
+	for _, want := range []string{"b", "", "q"} {
+		if got, err := keys.read(); err != nil || got != want {
+			t.Errorf("Expected answer %q, got %q (%v)", want, got, err)
+		}
+	}
+	if _, err := keys.read(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end of the input, got %v", err)
+	}
+}